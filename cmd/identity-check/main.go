@@ -0,0 +1,48 @@
+// Command identity-check lists accounts whose usernames or emails collide
+// once normalized (Unicode NFKC plus case folding). Such accounts have to be
+// renamed or merged before the normalized unique indexes can be created.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"webFianlBackend/internal/config"
+	"webFianlBackend/internal/db"
+)
+
+func main() {
+	cfg, flags, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil && len(flags.Args) > 0 {
+		err = fmt.Errorf("unexpected arguments %q", flags.Args)
+	}
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	if cfg.DBDSN == "" {
+		log.Fatal("config: db_dsn is required")
+	}
+	conn, err := db.Open(cfg.DBDriver, cfg.DBDSN)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collisions, err := db.FindIdentityCollisions(conn)
+	if err != nil {
+		log.Fatalf("identity check failed: %v", err)
+	}
+	if len(collisions) == 0 {
+		fmt.Println("no collisions")
+		return
+	}
+	for _, collision := range collisions {
+		fmt.Println(collision)
+	}
+	os.Exit(1)
+}
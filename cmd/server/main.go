@@ -1,22 +1,231 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"webFianlBackend/internal/config"
 	"webFianlBackend/internal/db"
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/metrics"
 	"webFianlBackend/internal/routes"
+	"webFianlBackend/internal/tracing"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/validation"
+	"webFianlBackend/internal/ws"
+
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
-	cfg := config.Load()
-	if cfg.JWTSecret == "change-me" {
-		log.Fatal("JWT_SECRET must be set to a non-default value")
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	cfg, flags, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err == nil && len(flags.Args) > 0 {
+		err = fmt.Errorf("unexpected arguments %q (the only subcommand is \"migrate\")", flags.Args)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if flags.PrintConfig {
+		if perr := cfg.Print(os.Stdout); perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		slog.Error("logger setup failed", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		fatal("jwt key setup failed", err)
+	}
+	mail, err := mailer.New(cfg.MailDriver, mailer.SMTPConfig{
+		Addr:     cfg.SMTPAddr,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	})
+	if err != nil {
+		fatal("mailer setup failed", err)
+	}
+	policy, err := validation.NewPolicy(validation.Config{
+		PasswordMinLength:     cfg.PasswordMinLength,
+		PasswordMaxLength:     cfg.PasswordMaxLength,
+		BreachedPasswordsFile: cfg.BreachedPasswordsFile,
+		UsernameMinLength:     cfg.UsernameMinLength,
+		UsernameMaxLength:     cfg.UsernameMaxLength,
+		UsernamePattern:       cfg.UsernamePattern,
+		ReservedUsernames:     cfg.ReservedUsernames,
+	})
+	if err != nil {
+		fatal("validation policy setup failed", err)
+	}
+	broadcaster, err := ws.NewBroadcaster(cfg.Broadcaster, ws.RedisConfig{
+		URL:    cfg.RedisURL,
+		Prefix: cfg.RedisPrefix,
+		NodeID: cfg.NodeID,
+	})
+	if err != nil {
+		fatal("broadcaster setup failed", err)
+	}
+	manager, err := ws.NewManager(broadcaster, ws.Options{
+		IdleTimeout:    cfg.HubIdleTimeout,
+		WriteWait:      cfg.WSWriteWait,
+		PongWait:       cfg.WSPongWait,
+		MaxMessageSize: int64(cfg.WSMaxMessageSize),
+		SendBuffer:     cfg.WSSendBuffer,
+	})
+	if err != nil {
+		fatal("websocket manager setup failed", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		ServiceName: cfg.ServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("tracing setup failed", err)
+	}
+	conn, err := db.Open(cfg.DBDriver, cfg.DBDSN)
+	if err != nil {
+		fatal("database setup failed", err)
+	}
+	if cfg.DBAutoMigrate {
+		migrator, err := db.NewMigrator(conn)
+		if err != nil {
+			fatal("loading migrations failed", err)
+		}
+		applied, err := migrator.Up(context.Background(), 0)
+		for _, migration := range applied {
+			slog.Info("migration applied", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			fatal("database migration failed", err)
+		}
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		fatal("database handle failed", err)
+	}
+	metrics.Registry.MustRegister(manager, collectors.NewDBStatsCollector(sqlDB, "irc"))
+
+	router := routes.SetupRouter(conn, cfg, keys, mail, policy, manager)
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: router,
+	}
+	slog.Info("listening", "addr", cfg.Addr)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("server failed", err)
+		}
+	}()
+
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+		metricsSrv = &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("metrics server failed", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	manager.Drain()
+	if cfg.ShutdownDelay > 0 {
+		slog.Info("marked not ready, waiting before draining", "delay", cfg.ShutdownDelay.String())
+		time.Sleep(cfg.ShutdownDelay)
+	}
+	slog.Info("shutting down, draining connections", "timeout", cfg.ShutdownTimeout.String())
+
+	// http.Server.Shutdown does not track hijacked WebSocket connections, so
+	// the hubs are drained alongside it.
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	httpDone := make(chan error, 1)
+	go func() {
+		httpDone <- srv.Shutdown(drainCtx)
+	}()
+	if err := manager.Shutdown(drainCtx); err != nil {
+		slog.Warn("websocket drain incomplete", "error", err)
+	}
+	if err := <-httpDone; err != nil {
+		slog.Warn("http drain incomplete", "error", err)
+	}
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(drainCtx)
+	}
+
+	if err := broadcaster.Close(); err != nil {
+		slog.Warn("broadcaster close failed", "error", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		slog.Warn("database close failed", "error", err)
+	}
+	if err := shutdownTracing(drainCtx); err != nil {
+		slog.Warn("tracing flush failed", "error", err)
+	}
+	slog.Info("shutdown complete")
+}
+
+// fatal logs err and exits; used for startup failures.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func loadKeys(cfg config.Config) (*utils.KeySet, error) {
+	if cfg.JWTAlgorithm == "HS256" {
+		return utils.NewHMACKeySet(cfg.JWTSecret), nil
 	}
-	conn := db.Init(cfg.DBDSN)
 
-	router := routes.SetupRouter(conn, cfg.JWTSecret, cfg.CORSOrigins)
-	if err := router.Run(cfg.Addr); err != nil {
-		log.Fatalf("server failed: %v", err)
+	// A configured shared secret keeps HS256 tokens issued before switching
+	// to asymmetric keys valid until they expire.
+	legacySecret := cfg.JWTSecret
+	if config.IsPlaceholderSecret(legacySecret) {
+		legacySecret = ""
 	}
+	return utils.LoadKeySet(utils.KeyConfig{
+		Algorithm:      cfg.JWTAlgorithm,
+		PrivateKeyFile: cfg.JWTPrivateKeyFile,
+		KeyID:          cfg.JWTKeyID,
+		VerifyKeyFiles: cfg.JWTVerifyKeyFiles,
+		LegacySecret:   legacySecret,
+	})
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"webFianlBackend/internal/config"
+	"webFianlBackend/internal/db"
+	"webFianlBackend/internal/logging"
+)
+
+const migrateUsage = `usage: server migrate [flags] <command>
+
+commands:
+  up [N]          apply all pending migrations, or only the next N
+  down [N]        revert the last N applied migrations (default 1)
+  status          list the migrations and whether they are applied
+  force VERSION   clear the dirty flag of VERSION after repairing it by hand
+
+The flags are the server's configuration flags, such as --config or --db-dsn.
+`
+
+// runMigrate implements "server migrate". Only the database settings are
+// required, so it can run as a deploy step without the server's secrets.
+func runMigrate(args []string) {
+	cfg, flags, err := config.Load(os.Args[0]+" migrate", args)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(os.Stderr, "\n"+migrateUsage)
+		return
+	}
+	if err == nil && cfg.DBDSN == "" {
+		err = errors.New("db_dsn: required")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if len(flags.Args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		fatal("logger setup failed", err)
+	}
+	slog.SetDefault(logger)
+
+	command, rest := flags.Args[0], flags.Args[1:]
+	var count int
+	switch command {
+	case "up", "down":
+		if command == "down" {
+			count = 1
+		}
+		if len(rest) > 1 {
+			usageError("too many arguments")
+		}
+		if len(rest) == 1 {
+			if count, err = strconv.Atoi(rest[0]); err != nil || count < 1 {
+				usageError("N must be a positive number")
+			}
+		}
+	case "status":
+		if len(rest) > 0 {
+			usageError("too many arguments")
+		}
+	case "force":
+		if len(rest) != 1 {
+			usageError("force takes exactly one VERSION")
+		}
+		if count, err = strconv.Atoi(rest[0]); err != nil {
+			usageError("VERSION must be a number")
+		}
+	default:
+		usageError(fmt.Sprintf("unknown command %q", command))
+	}
+
+	conn, err := db.Open(cfg.DBDriver, cfg.DBDSN)
+	if err != nil {
+		fatal("database setup failed", err)
+	}
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		fatal("loading migrations failed", err)
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, count)
+		printMigrations("applied", applied)
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		reverted, err := migrator.Down(ctx, count)
+		printMigrations("reverted", reverted)
+		if err != nil {
+			fatal("migration failed", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fatal("reading migrations failed", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := status.AppliedAt
+			switch {
+			case status.Dirty:
+				applied += " (dirty)"
+			case applied == "":
+				applied = "pending"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		w.Flush()
+	case "force":
+		if err := migrator.Force(ctx, count); err != nil {
+			fatal("force failed", err)
+		}
+		fmt.Printf("marked %04d as applied\n", count)
+	}
+}
+
+func printMigrations(verb string, migrations []db.Migration) {
+	for _, migration := range migrations {
+		fmt.Printf("%s %04d_%s\n", verb, migration.Version, migration.Name)
+	}
+}
+
+func usageError(msg string) {
+	fmt.Fprintf(os.Stderr, "%s\n\n%s", msg, migrateUsage)
+	os.Exit(2)
+}
@@ -1,31 +1,325 @@
+// Package config builds the server configuration from built-in defaults, an
+// optional YAML or TOML file, environment variables and command-line flags,
+// each layer overriding the one before it.
+//
+// Every field tagged `config` can be set in all three places: as key in the
+// file, as the environment variable named by its `env` tag, and as the flag
+// --key with underscores replaced by dashes. Fields tagged `redact` are
+// hidden by --print-config.
 package config
 
 import (
-	"os"
-
-	"github.com/joho/godotenv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	DBDSN     string
-	JWTSecret string
-	Addr      string
-	CORSOrigins string
+	DBDSN       string `config:"db_dsn" env:"DB_DSN" redact:"password"`
+	JWTSecret   string `config:"jwt_secret" env:"JWT_SECRET" redact:"all"`
+	Addr        string `config:"addr" env:"ADDR"`
+	CORSOrigins string `config:"cors_origins" env:"CORS_ORIGINS"`
+
+	// DBDriver is mysql (also MariaDB), postgres or sqlite; DBDSN is in
+	// that driver's format, a file path for sqlite. DBAutoMigrate applies
+	// pending migrations at startup. Turn it off to run "migrate up" as a
+	// separate deploy step instead.
+	DBDriver      string `config:"db_driver" env:"DB_DRIVER"`
+	DBAutoMigrate bool   `config:"db_auto_migrate" env:"DB_AUTO_MIGRATE"`
+
+	// JWTAlgorithm is HS256 (signed with JWTSecret) or RS256/EdDSA (signed
+	// with JWTPrivateKeyFile). JWTVerifyKeyFiles keeps retired keys valid.
+	JWTAlgorithm      string   `config:"jwt_algorithm" env:"JWT_ALG"`
+	JWTPrivateKeyFile string   `config:"jwt_private_key_file" env:"JWT_PRIVATE_KEY_FILE"`
+	JWTKeyID          string   `config:"jwt_key_id" env:"JWT_KEY_ID"`
+	JWTVerifyKeyFiles []string `config:"jwt_verify_key_files" env:"JWT_VERIFY_KEY_FILES"`
+	// TokenTTL is the lifetime of session tokens and their cookie.
+	TokenTTL time.Duration `config:"token_ttl" env:"TOKEN_TTL"`
+
+	// CookieSecure is "auto" (Secure only over TLS), "true" or "false";
+	// use "true" behind a TLS-terminating proxy. CookieSameSite is lax,
+	// strict or none.
+	CookieSecure   string `config:"cookie_secure" env:"COOKIE_SECURE"`
+	CookieDomain   string `config:"cookie_domain" env:"COOKIE_DOMAIN"`
+	CookieSameSite string `config:"cookie_same_site" env:"COOKIE_SAME_SITE"`
+
+	// AppURL is the public base URL used to build links sent by email.
+	AppURL       string `config:"app_url" env:"APP_URL"`
+	MailDriver   string `config:"mail_driver" env:"MAIL_DRIVER"`
+	MailFrom     string `config:"mail_from" env:"MAIL_FROM"`
+	SMTPAddr     string `config:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUsername string `config:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `config:"smtp_password" env:"SMTP_PASSWORD" redact:"all"`
+	// UnverifiedRestrictions lists actions denied until the email is verified.
+	UnverifiedRestrictions []string `config:"unverified_restrictions" env:"UNVERIFIED_RESTRICTIONS"`
+	// TOTPIssuer is the name authenticator apps show next to the account.
+	TOTPIssuer string `config:"totp_issuer" env:"TOTP_ISSUER"`
+
+	// OpenID Connect login is enabled when OIDCIssuer is set. The redirect
+	// and post-login URLs default to paths under AppURL.
+	OIDCIssuer       string   `config:"oidc_issuer" env:"OIDC_ISSUER"`
+	OIDCClientID     string   `config:"oidc_client_id" env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string   `config:"oidc_client_secret" env:"OIDC_CLIENT_SECRET" redact:"all"`
+	OIDCRedirectURL  string   `config:"oidc_redirect_url" env:"OIDC_REDIRECT_URL"`
+	OIDCScopes       []string `config:"oidc_scopes" env:"OIDC_SCOPES"`
+	// OIDCPostLoginURL is where the browser lands after a successful login.
+	OIDCPostLoginURL string `config:"oidc_post_login_url" env:"OIDC_POST_LOGIN_URL"`
+
+	PasswordMinLength     int      `config:"password_min_length" env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int      `config:"password_max_length" env:"PASSWORD_MAX_LENGTH"`
+	BreachedPasswordsFile string   `config:"breached_passwords_file" env:"BREACHED_PASSWORDS_FILE"`
+	UsernameMinLength     int      `config:"username_min_length" env:"USERNAME_MIN_LENGTH"`
+	UsernameMaxLength     int      `config:"username_max_length" env:"USERNAME_MAX_LENGTH"`
+	UsernamePattern       string   `config:"username_pattern" env:"USERNAME_PATTERN"`
+	ReservedUsernames     []string `config:"reserved_usernames" env:"RESERVED_USERNAMES"`
+
+	// Per-IP rate limits: at most N requests per window to the login and
+	// registration endpoints, to password reset, and to resending
+	// verification mail.
+	RateLimitAuth        int           `config:"rate_limit_auth" env:"RATE_LIMIT_AUTH"`
+	RateLimitAuthWindow  time.Duration `config:"rate_limit_auth_window" env:"RATE_LIMIT_AUTH_WINDOW"`
+	RateLimitReset       int           `config:"rate_limit_reset" env:"RATE_LIMIT_RESET"`
+	RateLimitResetWindow time.Duration `config:"rate_limit_reset_window" env:"RATE_LIMIT_RESET_WINDOW"`
+	RateLimitMail        int           `config:"rate_limit_mail" env:"RATE_LIMIT_MAIL"`
+	RateLimitMailWindow  time.Duration `config:"rate_limit_mail_window" env:"RATE_LIMIT_MAIL_WINDOW"`
+
+	// Broadcaster is "memory" for a single instance or "redis" to share
+	// channels and presence between replicas.
+	Broadcaster string `config:"broadcaster" env:"BROADCASTER"`
+	RedisURL    string `config:"redis_url" env:"REDIS_URL" redact:"password"`
+	RedisPrefix string `config:"redis_prefix" env:"REDIS_PREFIX"`
+	NodeID      string `config:"node_id" env:"NODE_ID"`
+	// HubIdleTimeout is how long a channel hub with no connections is kept.
+	HubIdleTimeout time.Duration `config:"ws_hub_idle_timeout" env:"WS_HUB_IDLE_TIMEOUT"`
+	// WSPongWait is how long a connection may stay silent before it is
+	// dropped; pings go out at 90% of it. WSMaxMessageSize is in bytes and
+	// WSSendBuffer is how many messages queue per connection before it
+	// counts as slow.
+	WSWriteWait      time.Duration `config:"ws_write_wait" env:"WS_WRITE_WAIT"`
+	WSPongWait       time.Duration `config:"ws_pong_wait" env:"WS_PONG_WAIT"`
+	WSMaxMessageSize int           `config:"ws_max_message_size" env:"WS_MAX_MESSAGE_SIZE"`
+	WSSendBuffer     int           `config:"ws_send_buffer" env:"WS_SEND_BUFFER"`
+	// ShutdownTimeout bounds how long SIGTERM waits for requests and
+	// WebSockets to drain.
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay keeps serving with /readyz failing for this long after
+	// SIGTERM, so load balancers stop sending traffic before draining.
+	ShutdownDelay time.Duration `config:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+
+	// MetricsAddr serves /metrics on its own listener instead of the API
+	// port; MetricsToken, when set, is required as a bearer token.
+	MetricsAddr  string `config:"metrics_addr" env:"METRICS_ADDR"`
+	MetricsToken string `config:"metrics_token" env:"METRICS_TOKEN" redact:"all"`
+
+	// LogFormat is "text" or "json"; LogLevel is debug, info, warn or error.
+	LogFormat string `config:"log_format" env:"LOG_FORMAT"`
+	LogLevel  string `config:"log_level" env:"LOG_LEVEL"`
+
+	// TracingExporter is "none", "otlp" or "stdout". TracingEndpoint is
+	// the OTLP/HTTP collector URL.
+	TracingExporter    string  `config:"tracing_exporter" env:"TRACING_EXPORTER"`
+	TracingEndpoint    string  `config:"tracing_endpoint" env:"OTLP_ENDPOINT"`
+	TracingSampleRatio float64 `config:"tracing_sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName        string  `config:"service_name" env:"OTEL_SERVICE_NAME"`
+
+	// sources records where each key's value came from, for Print.
+	sources map[string]string
 }
 
-func Load() Config {
-	_ = godotenv.Load()
+// Default returns the built-in values. DBDSN and, for HS256, JWTSecret have
+// no usable default and must be configured.
+func Default() Config {
 	return Config{
-		DBDSN:     getenv("DB_DSN", "root:password@tcp(127.0.0.1:3306)/irc?charset=utf8mb4&parseTime=True&loc=Local"),
-		JWTSecret: getenv("JWT_SECRET", "change-me"),
-		Addr:      getenv("ADDR", ":8080"),
-		CORSOrigins: getenv("CORS_ORIGINS", "http://localhost:5173,http://localhost:3000"),
+		DBDriver:      "mysql",
+		DBAutoMigrate: true,
+
+		Addr:        ":8080",
+		CORSOrigins: "http://localhost:5173,http://localhost:3000",
+
+		JWTAlgorithm: "HS256",
+		TokenTTL:     24 * time.Hour,
+
+		CookieSecure:   "auto",
+		CookieSameSite: "lax",
+
+		AppURL:                 "http://localhost:5173",
+		MailDriver:             "log",
+		MailFrom:               "no-reply@localhost",
+		UnverifiedRestrictions: []string{"create_channel"},
+		TOTPIssuer:             "IRC Chat",
+
+		OIDCScopes: []string{"openid", "email", "profile"},
+
+		PasswordMinLength: 8,
+		PasswordMaxLength: 72,
+		UsernameMinLength: 3,
+		UsernameMaxLength: 32,
+		UsernamePattern:   `^[A-Za-z0-9_.-]+$`,
+		ReservedUsernames: []string{"admin", "administrator", "root", "system", "support", "moderator", "me", "null", "undefined"},
+
+		RateLimitAuth:        10,
+		RateLimitAuthWindow:  5 * time.Minute,
+		RateLimitReset:       5,
+		RateLimitResetWindow: 15 * time.Minute,
+		RateLimitMail:        5,
+		RateLimitMailWindow:  time.Hour,
+
+		Broadcaster:      "memory",
+		RedisURL:         "redis://localhost:6379/0",
+		RedisPrefix:      "chat:",
+		HubIdleTimeout:   5 * time.Minute,
+		WSWriteWait:      10 * time.Second,
+		WSPongWait:       60 * time.Second,
+		WSMaxMessageSize: 1024,
+		WSSendBuffer:     256,
+		ShutdownTimeout:  30 * time.Second,
+
+		LogFormat: "text",
+		LogLevel:  "info",
+
+		TracingExporter:    "none",
+		TracingSampleRatio: 1,
+		ServiceName:        "irc-backend",
 	}
 }
 
-func getenv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// placeholderSecrets are values that have appeared in examples and docs.
+// They are public, so a token signed with one proves nothing.
+var placeholderSecrets = map[string]bool{
+	"change-me":   true,
+	"change-this": true,
+	"changeme":    true,
+	"secret":      true,
+}
+
+// IsPlaceholderSecret reports whether secret is a published example value.
+func IsPlaceholderSecret(secret string) bool {
+	return placeholderSecrets[strings.ToLower(strings.TrimSpace(secret))]
+}
+
+// Validate reports every setting that is missing, malformed or inconsistent.
+func (cfg Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		for _, v := range allowed {
+			if value == v {
+				return
+			}
+		}
+		fail(key, "%q is not one of %v", value, allowed)
+	}
+	positive := func(key string, d time.Duration) {
+		if d <= 0 {
+			fail(key, "must be a positive duration")
+		}
+	}
+	atLeast := func(key string, n, min int) {
+		if n < min {
+			fail(key, "must be at least %d", min)
+		}
+	}
+	absoluteURL := func(key, value string) {
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			fail(key, "%q is not an absolute URL", value)
+		}
+	}
+
+	if cfg.DBDSN == "" {
+		fail("db_dsn", "required")
+	}
+	oneOf("db_driver", cfg.DBDriver, "mysql", "postgres", "sqlite")
+	if cfg.Addr == "" {
+		fail("addr", "required")
+	}
+
+	oneOf("jwt_algorithm", cfg.JWTAlgorithm, "HS256", "RS256", "EdDSA")
+	if cfg.JWTAlgorithm == "HS256" && (cfg.JWTSecret == "" || IsPlaceholderSecret(cfg.JWTSecret)) {
+		fail("jwt_secret", "required for HS256 and must not be an example value")
+	}
+	if cfg.JWTAlgorithm != "HS256" && cfg.JWTPrivateKeyFile == "" {
+		fail("jwt_private_key_file", "required for %s", cfg.JWTAlgorithm)
+	}
+	positive("token_ttl", cfg.TokenTTL)
+
+	oneOf("cookie_secure", cfg.CookieSecure, "auto", "true", "false")
+	oneOf("cookie_same_site", cfg.CookieSameSite, "lax", "strict", "none")
+	if cfg.CookieSameSite == "none" && cfg.CookieSecure != "true" {
+		fail("cookie_same_site", "none requires cookie_secure true")
+	}
+
+	absoluteURL("app_url", cfg.AppURL)
+	oneOf("mail_driver", cfg.MailDriver, "log", "smtp")
+	if cfg.MailDriver == "smtp" && cfg.SMTPAddr == "" {
+		fail("smtp_addr", "required when mail_driver is smtp")
+	}
+
+	if cfg.OIDCIssuer != "" {
+		absoluteURL("oidc_issuer", cfg.OIDCIssuer)
+		absoluteURL("oidc_redirect_url", cfg.OIDCRedirectURL)
+		if cfg.OIDCClientID == "" {
+			fail("oidc_client_id", "required when oidc_issuer is set")
+		}
+	}
+
+	atLeast("password_min_length", cfg.PasswordMinLength, 1)
+	atLeast("password_max_length", cfg.PasswordMaxLength, cfg.PasswordMinLength)
+	atLeast("username_min_length", cfg.UsernameMinLength, 1)
+	atLeast("username_max_length", cfg.UsernameMaxLength, cfg.UsernameMinLength)
+	if _, err := regexp.Compile(cfg.UsernamePattern); err != nil {
+		fail("username_pattern", "%v", err)
+	}
+
+	atLeast("rate_limit_auth", cfg.RateLimitAuth, 1)
+	positive("rate_limit_auth_window", cfg.RateLimitAuthWindow)
+	atLeast("rate_limit_reset", cfg.RateLimitReset, 1)
+	positive("rate_limit_reset_window", cfg.RateLimitResetWindow)
+	atLeast("rate_limit_mail", cfg.RateLimitMail, 1)
+	positive("rate_limit_mail_window", cfg.RateLimitMailWindow)
+
+	oneOf("broadcaster", cfg.Broadcaster, "memory", "redis")
+	if cfg.Broadcaster == "redis" {
+		absoluteURL("redis_url", cfg.RedisURL)
+	}
+	positive("ws_hub_idle_timeout", cfg.HubIdleTimeout)
+	positive("ws_write_wait", cfg.WSWriteWait)
+	positive("ws_pong_wait", cfg.WSPongWait)
+	atLeast("ws_max_message_size", cfg.WSMaxMessageSize, 1)
+	atLeast("ws_send_buffer", cfg.WSSendBuffer, 1)
+	positive("shutdown_timeout", cfg.ShutdownTimeout)
+	if cfg.ShutdownDelay < 0 {
+		fail("shutdown_delay", "must not be negative")
+	}
+
+	oneOf("log_format", cfg.LogFormat, "text", "json")
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		fail("log_level", "%q is not one of debug, info, warn, error", cfg.LogLevel)
+	}
+
+	oneOf("tracing_exporter", cfg.TracingExporter, "none", "otlp", "stdout")
+	if cfg.TracingSampleRatio < 0 || cfg.TracingSampleRatio > 1 {
+		fail("tracing_sample_ratio", "must be between 0 and 1")
+	}
+
+	return errors.Join(errs...)
+}
+
+// SameSite converts CookieSameSite for net/http.
+func (cfg Config) SameSite() http.SameSite {
+	switch cfg.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
 	}
-	return fallback
 }
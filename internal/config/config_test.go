@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateJWTSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		ok     bool
+	}{
+		{"", false},
+		{"change-me", false},
+		{"change-this", false},
+		{" Change-This ", false},
+		{"k5Zb1yq0Jc3oQ8mVxT2rW9uE4nH7aL6s", true},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.DBDSN = "file::memory:"
+		cfg.JWTSecret = tt.secret
+		err := cfg.Validate()
+		rejected := err != nil && strings.Contains(err.Error(), "jwt_secret")
+		if rejected == tt.ok {
+			t.Errorf("jwt_secret %q: Validate = %v", tt.secret, err)
+		}
+	}
+}
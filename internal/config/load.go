@@ -0,0 +1,285 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Flags are the command-line switches that are not configuration values.
+type Flags struct {
+	// ConfigFile is the YAML or TOML file layered under the environment.
+	// It defaults to $CONFIG_FILE.
+	ConfigFile string
+	// PrintConfig asks for the effective configuration to be printed
+	// instead of starting.
+	PrintConfig bool
+	// Args are the arguments left after the flags, such as a subcommand's.
+	Args []string
+}
+
+// Load reads .env into the environment, then layers the config file,
+// environment variables and flags parsed from args over Default. It reports
+// unknown keys and malformed values, but not invalid combinations; call
+// Validate for those. The returned Config is filled in as far as possible
+// even when an error is returned. name is the program name for usage output.
+func Load(name string, args []string) (Config, Flags, error) {
+	_ = godotenv.Load()
+
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+	fields := cfg.fields()
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+	}
+
+	var flags Flags
+	type flagValue struct {
+		field field
+		raw   string
+	}
+	var flagValues []flagValue
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&flags.ConfigFile, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file` (env CONFIG_FILE)")
+	fs.BoolVar(&flags.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	for _, f := range fields {
+		f := f
+		record := func(raw string) error {
+			flagValues = append(flagValues, flagValue{field: f, raw: raw})
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(flagName(f.key), "overrides env "+f.env, record)
+		} else {
+			fs.Func(flagName(f.key), "overrides env "+f.env, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, flags, err
+	}
+	flags.Args = fs.Args()
+
+	var errs []error
+	if flags.ConfigFile != "" {
+		values, err := readFile(flags.ConfigFile)
+		if err != nil {
+			return cfg, flags, err
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			f, ok := byKey[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown key %q", flags.ConfigFile, key))
+				continue
+			}
+			if err := f.setFileValue(values[key]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", flags.ConfigFile, key, err))
+				continue
+			}
+			cfg.sources[key] = "file"
+		}
+	}
+
+	// An empty variable counts as unset, as it always has.
+	for _, f := range fields {
+		raw := os.Getenv(f.env)
+		if raw == "" {
+			continue
+		}
+		if err := f.set(raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			continue
+		}
+		cfg.sources[f.key] = "env " + f.env
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.field.set(fv.raw); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", flagName(fv.field.key), err))
+			continue
+		}
+		cfg.sources[fv.field.key] = "flag --" + flagName(fv.field.key)
+	}
+
+	cfg.AppURL = strings.TrimRight(cfg.AppURL, "/")
+	if cfg.OIDCRedirectURL == "" {
+		cfg.OIDCRedirectURL = cfg.AppURL + "/api/auth/oidc/callback"
+		cfg.sources["oidc_redirect_url"] = "default, from app_url"
+	}
+	if cfg.OIDCPostLoginURL == "" {
+		cfg.OIDCPostLoginURL = cfg.AppURL + "/"
+		cfg.sources["oidc_post_login_url"] = "default, from app_url"
+	}
+
+	return cfg, flags, errors.Join(errs...)
+}
+
+// field is one configurable Config field.
+type field struct {
+	key    string
+	env    string
+	redact string
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields lists the tagged fields of cfg; setting them modifies cfg.
+func (cfg *Config) fields() []field {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		if tag.Get("config") == "" {
+			continue
+		}
+		fields = append(fields, field{
+			key:    tag.Get("config"),
+			env:    tag.Get("env"),
+			redact: tag.Get("redact"),
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+// set parses raw as the field's type. Lists are comma-separated, and
+// "none" is the empty list.
+func (f field) set(raw string) error {
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (want e.g. \"30s\" or \"5m\")", raw)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(raw)
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		f.value.SetFloat(n)
+	case f.value.Kind() == reflect.Slice:
+		f.value.Set(reflect.ValueOf(splitList(raw)))
+	default:
+		panic("config: unsupported field type " + f.value.Type().String())
+	}
+	return nil
+}
+
+// setFileValue sets the field from a decoded YAML or TOML value. Lists may
+// be written natively or as a comma-separated string.
+func (f field) setFileValue(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return f.set("")
+	case string:
+		return f.set(v)
+	case []interface{}:
+		if f.value.Kind() != reflect.Slice {
+			return errors.New("must be a single value, not a list")
+		}
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case []interface{}, map[string]interface{}:
+				return errors.New("list items must be plain values")
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		f.value.Set(reflect.ValueOf(items))
+		return nil
+	default:
+		return f.set(fmt.Sprint(v))
+	}
+}
+
+// readFile decodes a YAML or TOML file, chosen by extension, into flat
+// keys. Nested tables are joined with underscores, so ws: {pong_wait: 60s}
+// sets ws_pong_wait.
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type (want .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]interface{})
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, out map[string]interface{}) {
+	for key, value := range doc {
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(key, nested, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// splitList splits a comma-separated value, dropping empty entries. "none"
+// yields an empty list.
+func splitList(raw string) []string {
+	if raw == "none" {
+		return nil
+	}
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+var (
+	dsnPassword     = regexp.MustCompile(`^([^:@/]*):([^@]*)@`)
+	keywordPassword = regexp.MustCompile(`(?i)(password=)\S+`)
+)
+
+// Print writes the configuration as YAML in the file format, with the
+// source of each value as a comment. Secrets are redacted, so the output is
+// safe to share but cannot be loaded back unchanged.
+func (cfg Config) Print(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, f := range cfg.fields() {
+		value := f.node()
+		source := cfg.sources[f.key]
+		if source == "" {
+			source = "default"
+		}
+		value.LineComment = source
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// node renders the field's value, redacted if its tag asks for it.
+func (f field) node() *yaml.Node {
+	switch {
+	case f.value.Type() == durationType:
+		d := time.Duration(f.value.Int())
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.String()}
+	case f.value.Kind() == reflect.Int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatInt(f.value.Int(), 10)}
+	case f.value.Kind() == reflect.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatBool(f.value.Bool())}
+	case f.value.Kind() == reflect.Float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatFloat(f.value.Float(), 'f', -1, 64)}
+	case f.value.Kind() == reflect.Slice:
+		list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range f.value.Interface().([]string) {
+			list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+		}
+		return list
+	default:
+		value := f.value.String()
+		switch {
+		case value == "":
+		case f.redact == "all":
+			value = redacted
+		case f.redact == "password":
+			value = redactPassword(value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	}
+}
+
+// redactPassword hides the password in a URL, a MySQL DSN
+// (user:pass@tcp(host)/db) or a key=value connection string.
+func redactPassword(value string) string {
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil {
+			return u.Redacted()
+		}
+		return redacted
+	}
+	value = dsnPassword.ReplaceAllString(value, "$1:xxxxx@")
+	return keywordPassword.ReplaceAllString(value, "${1}xxxxx")
+}
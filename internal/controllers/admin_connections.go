@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"webFianlBackend/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListHubs reports every running channel hub with its connection count.
+func (ac *AdminController) ListHubs(c *gin.Context) {
+	hubs := ac.Manager.Hubs()
+	total := 0
+	for _, hub := range hubs {
+		total += hub.Clients
+	}
+
+	c.JSON(http.StatusOK, gin.H{"hubs": hubs, "connections": total, "metrics": ac.Manager.Metrics()})
+}
+
+// ListHubClients lists the connections of one channel's hub.
+func (ac *AdminController) ListHubClients(c *gin.Context) {
+	channelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+		return
+	}
+
+	hub, ok := ac.Manager.Lookup(uint(channelID))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no live hub for channel"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hub.Clients())
+}
+
+// DisconnectLocalClient closes a single connection by its client ID. Like
+// the hub listings it only sees this node's connections.
+func (ac *AdminController) DisconnectLocalClient(c *gin.Context) {
+	clientID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
+		return
+	}
+
+	client, ok := ac.Manager.DisconnectLocalClient(clientID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "client not connected to this node"})
+		return
+	}
+
+	audit.Record(ac.Audit, c, audit.Event{
+		Action:       audit.ActionAdminDisconnect,
+		TargetUserID: client.UserID,
+		ChannelID:    client.ChannelID,
+		Metadata:     map[string]interface{}{"client_id": clientID, "closed": 1},
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "disconnected"})
+}
+
+// DisconnectUser closes every connection of a user. Their sessions stay
+// valid, so clients may reconnect; suspend the account to keep them out.
+func (ac *AdminController) DisconnectUser(c *gin.Context) {
+	user, ok := ac.user(c)
+	if !ok {
+		return
+	}
+
+	closed := ac.Manager.DisconnectUser(user.ID)
+
+	audit.Record(ac.Audit, c, audit.Event{
+		Action:       audit.ActionAdminDisconnect,
+		TargetUserID: user.ID,
+		Metadata:     map[string]interface{}{"closed": closed},
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "disconnected", "closed": closed})
+}
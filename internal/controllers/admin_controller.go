@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/service"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController holds the site-operator endpoints under /api/admin. Every
+// change it makes is written to the audit log.
+type AdminController struct {
+	Users    store.Users
+	Accounts store.Accounts
+	Logins   store.Logins
+	Audit    store.Audit
+	Channels *service.Channels
+	Manager  *ws.Manager
+}
+
+// adminUser exposes the account state that User hides from its owner.
+type adminUser struct {
+	models.User
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until"`
+}
+
+func newAdminUser(user models.User) adminUser {
+	return adminUser{User: user, FailedLogins: user.FailedLogins, LockedUntil: user.LockedUntil}
+}
+
+type suspendPayload struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// ListUsers searches users by name or email, newest first. Older pages are
+// fetched with before_id.
+func (ac *AdminController) ListUsers(c *gin.Context) {
+	filter := store.UserFilter{Query: utils.IdentityKey(c.Query("query"))}
+	switch c.Query("status") {
+	case "":
+	case "suspended":
+		filter.Suspended = true
+	case "locked":
+		filter.Locked = true
+	case "admin":
+		filter.Admin = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be suspended, locked or admin"})
+		return
+	}
+	if !queryID(c, "before_id", &filter.BeforeID) {
+		return
+	}
+	limit, ok := pageLimit(c)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	users, err := ac.Accounts.List(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list users failed"})
+		return
+	}
+
+	response := make([]adminUser, 0, len(users))
+	for _, user := range users {
+		response = append(response, newAdminUser(user))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (ac *AdminController) GetUser(c *gin.Context) {
+	user, ok := ac.user(c)
+	if !ok {
+		return
+	}
+
+	usage, err := ac.Accounts.Usage(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load user failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":            newAdminUser(user),
+		"owned_channels":  usage.OwnedChannels,
+		"active_sessions": usage.ActiveSessions,
+		"tokens":          usage.Tokens,
+	})
+}
+
+// user loads the user named by the id path parameter. It writes the error
+// response itself.
+func (ac *AdminController) user(c *gin.Context) (models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return models.User{}, false
+	}
+	user, err := ac.Users.ByID(c, uint(id))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return user, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load user failed"})
+		return user, false
+	}
+	return user, true
+}
+
+// Suspend blocks the account: its sessions are revoked, its sockets closed,
+// and Auth rejects its personal access tokens until Unsuspend.
+func (ac *AdminController) Suspend(c *gin.Context) {
+	// The body, and with it the reason, is optional.
+	var payload suspendPayload
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+	}
+
+	user, ok := ac.user(c)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetUint(middleware.ContextUserIDKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot suspend yourself"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "user already suspended"})
+		return
+	}
+
+	sessionIDs, err := ac.Accounts.Suspend(c, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "suspend user failed"})
+		return
+	}
+	ac.Manager.DisconnectSessions(sessionIDs...)
+
+	audit.Record(ac.Audit, c, audit.Event{
+		Action:       audit.ActionAdminSuspend,
+		TargetUserID: user.ID,
+		Metadata:     map[string]interface{}{"reason": payload.Reason},
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "suspended"})
+}
+
+func (ac *AdminController) Unsuspend(c *gin.Context) {
+	user, ok := ac.user(c)
+	if !ok {
+		return
+	}
+	if user.SuspendedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "user not suspended"})
+		return
+	}
+
+	if err := ac.Accounts.Unsuspend(c, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unsuspend user failed"})
+		return
+	}
+
+	audit.Record(ac.Audit, c, audit.Event{Action: audit.ActionAdminUnsuspend, TargetUserID: user.ID})
+	c.JSON(http.StatusOK, gin.H{"status": "unsuspended"})
+}
+
+// Unlock lifts a login-throttling lockout, as the emailed unlock link does.
+func (ac *AdminController) Unlock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if err := ac.Logins.Unlock(c, uint(id)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unlock user failed"})
+		return
+	}
+
+	audit.Record(ac.Audit, c, audit.Event{Action: audit.ActionAdminUnlock, TargetUserID: uint(id)})
+	c.JSON(http.StatusOK, gin.H{"status": "unlocked"})
+}
+
+// DeleteChannel removes any channel regardless of owner.
+func (ac *AdminController) DeleteChannel(c *gin.Context) {
+	channel, err := ac.Channels.ForceDelete(c, channelParam(c))
+	if err != nil {
+		channelError(c, err, "delete channel failed")
+		return
+	}
+	ac.Manager.CloseChannel(channel.ID, ws.CloseChannelDeleted, "channel deleted")
+
+	audit.Record(ac.Audit, c, audit.Event{
+		Action:       audit.ActionAdminChannelDelete,
+		TargetUserID: channel.OwnerID,
+		ChannelID:    channel.ID,
+		Metadata:     map[string]interface{}{"name": channel.Name},
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// Stats reports server-wide counts. Login figures cover the last 24 hours.
+func (ac *AdminController) Stats(c *gin.Context) {
+	counts, err := ac.Accounts.Stats(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "load stats failed"})
+		return
+	}
+	stats := gin.H{
+		"users":                  counts.Users,
+		"admins":                 counts.Admins,
+		"suspended_users":        counts.SuspendedUsers,
+		"locked_users":           counts.LockedUsers,
+		"unverified_users":       counts.UnverifiedUsers,
+		"channels":               counts.Channels,
+		"memberships":            counts.Memberships,
+		"active_sessions":        counts.ActiveSessions,
+		"personal_access_tokens": counts.PersonalAccessTokens,
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	for name, action := range map[string]string{
+		"logins_24h":        audit.ActionLogin,
+		"failed_logins_24h": audit.ActionLoginFailed,
+	} {
+		n, err := ac.Audit.Count(c, store.AuditFilter{Action: action, Since: since})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "load stats failed"})
+			return
+		}
+		stats[name] = n
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/service"
+	"webFianlBackend/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+type AuditController struct {
+	Audit    store.Audit
+	Channels *service.Channels
+}
+
+// ListChannel returns the audit trail of a channel to its owner, newest
+// first. Older pages are fetched with before_id.
+func (ac *AuditController) ListChannel(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	channel, err := ac.Channels.Owner(c, userID, channelParam(c))
+	if err != nil {
+		channelError(c, err, "channel lookup failed")
+		return
+	}
+
+	ac.list(c, store.AuditFilter{ChannelID: channel.ID})
+}
+
+// ListAll returns events across the whole server; it also filters by
+// target_user_id and channel_id.
+func (ac *AuditController) ListAll(c *gin.Context) {
+	var filter store.AuditFilter
+	if !queryID(c, "target_user_id", &filter.TargetUserID) || !queryID(c, "channel_id", &filter.ChannelID) {
+		return
+	}
+	ac.list(c, filter)
+}
+
+// list applies the filters shared by both listings: action, actor_id,
+// since/until (RFC 3339), before_id and limit.
+func (ac *AuditController) list(c *gin.Context, filter store.AuditFilter) {
+	filter.Action = c.Query("action")
+	if !queryID(c, "actor_id", &filter.ActorID) || !queryID(c, "before_id", &filter.BeforeID) {
+		return
+	}
+	if !queryTime(c, "since", &filter.Since) || !queryTime(c, "until", &filter.Until) {
+		return
+	}
+
+	limit, ok := pageLimit(c)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	events, err := ac.Audit.List(c, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list audit events failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// queryID reads an optional ID query parameter into dst. It writes the 400
+// itself when invalid.
+func queryID(c *gin.Context, param string, dst *uint) bool {
+	raw := c.Query(param)
+	if raw == "" {
+		return true
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+		return false
+	}
+	*dst = uint(id)
+	return true
+}
+
+// queryTime reads an optional RFC 3339 query parameter into dst. It writes
+// the 400 itself when invalid.
+func queryTime(c *gin.Context, param string, dst *time.Time) bool {
+	raw := c.Query(param)
+	if raw == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param})
+		return false
+	}
+	*dst = t
+	return true
+}
+
+// pageLimit reads the limit query parameter, defaulting to defaultPageSize
+// and capping at maxPageSize. It writes the 400 itself when invalid.
+func pageLimit(c *gin.Context) (int, bool) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageSize, true
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return 0, false
+	}
+	if n > maxPageSize {
+		n = maxPageSize
+	}
+	return n, true
+}
@@ -1,34 +1,82 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/mailer"
 	"webFianlBackend/internal/middleware"
 	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
 	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/validation"
+	"webFianlBackend/internal/ws"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type AuthController struct {
-	DB        *gorm.DB
-	JWTSecret string
+	Users      store.Users
+	Accounts   store.Accounts
+	Logins     store.Logins
+	Sessions   store.Sessions
+	Audit      store.Audit
+	Keys       *utils.KeySet
+	Policy     *validation.Policy
+	Manager    *ws.Manager
+	Mailer     mailer.Mailer
+	AppURL     string
+	TOTPIssuer string
+	// TokenTTL is the lifetime of session tokens and their cookie.
+	TokenTTL time.Duration
+	Cookies  CookieOptions
 }
 
 const authCookieName = "auth_token"
 
-func setAuthCookie(c *gin.Context, token string) {
-	secure := c.Request.TLS != nil
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(authCookieName, token, int((24 * time.Hour).Seconds()), "/", "", secure, true)
+func (a *AuthController) setAuthCookie(c *gin.Context, token string) {
+	a.Cookies.set(c, authCookieName, token, int(a.TokenTTL.Seconds()), "/")
 }
 
-func clearAuthCookie(c *gin.Context) {
-	secure := c.Request.TLS != nil
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(authCookieName, "", -1, "/", "", secure, true)
+// respondInvalid reports field-level validation problems.
+func respondInvalid(c *gin.Context, errs validation.FieldErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "fields": errs})
+}
+
+// startSession records a new server-side session for user and sets the auth
+// cookie carrying a token bound to it.
+func (a *AuthController) startSession(c *gin.Context, user models.User) error {
+	sessionID, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := models.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IP:         c.ClientIP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(a.TokenTTL),
+	}
+	if err := a.Sessions.Create(c, &session); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Username, session.ID, user.TokenVersion, a.TokenTTL, a.Keys)
+	if err != nil {
+		return err
+	}
+
+	a.setAuthCookie(c, token)
+	return nil
 }
 
 type authPayload struct {
@@ -43,13 +91,31 @@ func (a *AuthController) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
+	payload.Name = utils.NormalizeIdentity(payload.Name)
+	payload.Email = utils.NormalizeIdentity(payload.Email)
 	if payload.Name == "" || payload.Email == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name and email are required"})
 		return
 	}
 
-	var existing models.User
-	if err := a.DB.Where("username = ? OR email = ?", payload.Name, payload.Email).First(&existing).Error; err == nil {
+	errs := validation.FieldErrors{}
+	if msg := a.Policy.Username(payload.Name); msg != "" {
+		errs["name"] = msg
+	}
+	if msg := a.Policy.Email(payload.Email); msg != "" {
+		errs["email"] = msg
+	}
+	if msg := a.Policy.Password(payload.Password, payload.Name, payload.Email); msg != "" {
+		errs["password"] = msg
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	_, nameErr := a.Users.ByUsername(c, payload.Name)
+	_, emailErr := a.Users.ByEmail(c, payload.Email)
+	if nameErr == nil || emailErr == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "name or email already exists"})
 		return
 	}
@@ -65,18 +131,23 @@ func (a *AuthController) Register(c *gin.Context) {
 		Email:    payload.Email,
 		Password: hash,
 	}
-	if err := a.DB.Create(&user).Error; err != nil {
+	if err := a.Users.Create(c, &user); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "name or email already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "create user failed"})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Username, a.JWTSecret)
-	if err != nil {
+	if err := a.startSession(c, user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
 		return
 	}
 
-	setAuthCookie(c, token)
+	audit.Record(a.Audit, c, audit.Event{Action: audit.ActionRegister, ActorID: user.ID, ActorName: user.Username})
+	a.sendVerificationAsync(c, user)
+
 	c.JSON(http.StatusCreated, gin.H{"user": user})
 }
 
@@ -91,31 +162,62 @@ func (a *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	identifier := payload.Email
+	if identifier == "" {
+		identifier = payload.Name
+	}
+
 	var user models.User
+	var err error
 	if payload.Email != "" {
-		if err := a.DB.Where("email = ?", payload.Email).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-			return
-		}
+		user, err = a.Users.ByEmail(c, payload.Email)
 	} else {
-		if err := a.DB.Where("username = ?", payload.Name).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
-			return
-		}
+		user, err = a.Users.ByUsername(c, payload.Name)
+	}
+	if err != nil {
+		utils.CheckNoPassword(payload.Password)
+		a.recordLoginAttempt(c, nil, identifier, loginFailUnknownAccount)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	if a.loginBlocked(c, user, identifier) {
+		return
 	}
 
 	if !utils.CheckPassword(user.Password, payload.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		a.loginFailed(c, user, identifier, loginFailBadPassword, "invalid credentials")
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account suspended"})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Username, a.JWTSecret)
-	if err != nil {
+	// With 2FA on, the password only earns a short-lived pending token that
+	// LoginTwoFactor exchanges for a session.
+	if user.TOTPEnabled {
+		pending, err := utils.GenerateTwoFactorToken(user.ID, user.TokenVersion, a.Keys)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "pending_token": pending})
+		return
+	}
+
+	if err := a.startSession(c, user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
 		return
 	}
+	a.loginSucceeded(c, user)
+	audit.Record(a.Audit, c, audit.Event{
+		Action:    audit.ActionLogin,
+		ActorID:   user.ID,
+		ActorName: user.Username,
+		Metadata:  map[string]interface{}{"method": "password"},
+	})
 
-	setAuthCookie(c, token)
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
@@ -128,8 +230,8 @@ type profileUpdatePayload struct {
 func (a *AuthController) Me(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
 
-	var user models.User
-	if err := a.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
@@ -145,20 +247,52 @@ func (a *AuthController) UpdateMe(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
+	payload.Name = utils.NormalizeIdentity(payload.Name)
+	payload.Email = utils.NormalizeIdentity(payload.Email)
 	if payload.Name == "" && payload.Email == "" && payload.Password == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no updates provided"})
 		return
 	}
 
-	var user models.User
-	if err := a.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
 		return
 	}
 
+	errs := validation.FieldErrors{}
+	if payload.Name != "" && payload.Name != user.Username {
+		if msg := a.Policy.Username(payload.Name); msg != "" {
+			errs["name"] = msg
+		}
+	}
+	if payload.Email != "" && payload.Email != user.Email {
+		if msg := a.Policy.Email(payload.Email); msg != "" {
+			errs["email"] = msg
+		}
+	}
+	if payload.Password != "" {
+		name, email := user.Username, user.Email
+		if payload.Name != "" {
+			name = payload.Name
+		}
+		if payload.Email != "" {
+			email = payload.Email
+		}
+		if msg := a.Policy.Password(payload.Password, name, email); msg != "" {
+			errs["password"] = msg
+		}
+	}
+	if len(errs) > 0 {
+		respondInvalid(c, errs)
+		return
+	}
+
+	credentialsChanged := false
+	emailChanged := false
+	oldEmail := user.Email
 	if payload.Name != "" && payload.Name != user.Username {
-		var existing models.User
-		if err := a.DB.Where("username = ? AND id <> ?", payload.Name, user.ID).First(&existing).Error; err == nil {
+		if existing, err := a.Users.ByUsername(c, payload.Name); err == nil && existing.ID != user.ID {
 			c.JSON(http.StatusConflict, gin.H{"error": "name already exists"})
 			return
 		}
@@ -166,12 +300,14 @@ func (a *AuthController) UpdateMe(c *gin.Context) {
 	}
 
 	if payload.Email != "" && payload.Email != user.Email {
-		var existing models.User
-		if err := a.DB.Where("email = ? AND id <> ?", payload.Email, user.ID).First(&existing).Error; err == nil {
+		if existing, err := a.Users.ByEmail(c, payload.Email); err == nil && existing.ID != user.ID {
 			c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
 			return
 		}
 		user.Email = payload.Email
+		user.EmailVerifiedAt = nil
+		emailChanged = true
+		credentialsChanged = true
 	}
 
 	if payload.Password != "" {
@@ -181,65 +317,82 @@ func (a *AuthController) UpdateMe(c *gin.Context) {
 			return
 		}
 		user.Password = hash
+		credentialsChanged = true
 	}
 
-	if err := a.DB.Save(&user).Error; err != nil {
+	// A password or email change invalidates every previously issued token,
+	// personal access tokens included; only the current session survives,
+	// with a freshly signed token.
+	sessionID := c.GetString(middleware.ContextSessionIDKey)
+	revokedSessions, err := a.Accounts.UpdateProfile(c, &user, credentialsChanged, sessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "name or email already exists"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "update profile failed"})
 		return
 	}
+	a.Manager.DisconnectSessions(revokedSessions...)
 
-	token, err := utils.GenerateToken(user.ID, user.Username, a.JWTSecret)
+	if payload.Password != "" {
+		audit.Record(a.Audit, c, audit.Event{Action: audit.ActionPasswordChange, TargetUserID: user.ID})
+	}
+	if emailChanged {
+		audit.Record(a.Audit, c, audit.Event{
+			Action:       audit.ActionEmailChange,
+			TargetUserID: user.ID,
+			Metadata:     map[string]interface{}{"from": oldEmail, "to": user.Email},
+		})
+	}
+
+	if emailChanged {
+		a.sendVerificationAsync(c, user)
+	}
+
+	token, err := utils.GenerateToken(user.ID, user.Username, sessionID, user.TokenVersion, a.TokenTTL, a.Keys)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
 		return
 	}
 
-	setAuthCookie(c, token)
+	a.setAuthCookie(c, token)
 	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
 func (a *AuthController) DeleteMe(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
 
-	err := a.DB.Transaction(func(tx *gorm.DB) error {
-		var ownedChannels []models.Channel
-		if err := tx.Where("owner_id = ?", userID).Find(&ownedChannels).Error; err != nil {
-			return err
-		}
-
-		if len(ownedChannels) > 0 {
-			var channelIDs []uint
-			for _, ch := range ownedChannels {
-				channelIDs = append(channelIDs, ch.ID)
-			}
-			if err := tx.Where("channel_id IN ?", channelIDs).Delete(&models.ChannelMember{}).Error; err != nil {
-				return err
-			}
-			if err := tx.Where("owner_id = ?", userID).Delete(&models.Channel{}).Error; err != nil {
-				return err
-			}
-		}
-
-		if err := tx.Where("user_id = ?", userID).Delete(&models.ChannelMember{}).Error; err != nil {
-			return err
-		}
-
-		if err := tx.Where("id = ?", userID).Delete(&models.User{}).Error; err != nil {
-			return err
-		}
-
-		return nil
-	})
+	deletedChannels, sessionIDs, err := a.Accounts.Delete(c, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete account failed"})
 		return
 	}
 
-	clearAuthCookie(c)
+	a.Manager.DisconnectSessions(sessionIDs...)
+	for _, channelID := range deletedChannels {
+		a.Manager.CloseChannel(channelID, ws.CloseChannelDeleted, "channel deleted")
+	}
+	audit.Record(a.Audit, c, audit.Event{
+		Action:       audit.ActionAccountDelete,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"deleted_channels": deletedChannels},
+	})
+	a.Cookies.clear(c, authCookieName, "/")
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
 func (a *AuthController) Logout(c *gin.Context) {
-	clearAuthCookie(c)
+	userID := c.GetUint(middleware.ContextUserIDKey)
+	sessionID := c.GetString(middleware.ContextSessionIDKey)
+
+	if err := a.Sessions.Delete(c, userID, sessionID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "logout failed"})
+		return
+	}
+
+	a.Manager.DisconnectSessions(sessionID)
+	audit.Record(a.Audit, c, audit.Event{Action: audit.ActionLogout})
+	a.Cookies.clear(c, authCookieName, "/")
 	c.JSON(http.StatusOK, gin.H{"status": "logged_out"})
 }
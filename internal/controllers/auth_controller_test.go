@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// blockingMailer holds every message until release is closed.
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan mailer.Message
+}
+
+func (m blockingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.sent <- msg
+	return nil
+}
+
+func TestRegisterSendsVerificationInBackground(t *testing.T) {
+	a, _, _ := newTestAuth(t)
+	mail := blockingMailer{release: make(chan struct{}), sent: make(chan mailer.Message, 1)}
+	a.Mailer = mail
+
+	done := make(chan int, 1)
+	go func() {
+		w := serve(a.Register, http.MethodPost, "/api/register", authPayload{Name: "bob", Email: "bob@example.com", Password: "a good password"}, 0)
+		done <- w.Code
+	}()
+	select {
+	case status := <-done:
+		if status != http.StatusCreated {
+			t.Fatalf("Register = %d, want 201", status)
+		}
+	case <-time.After(2 * time.Second):
+		close(mail.release)
+		t.Fatal("Register waited for the verification mail")
+	}
+
+	close(mail.release)
+	select {
+	case msg := <-mail.sent:
+		if msg.To != "bob@example.com" || !strings.Contains(msg.Body, "http://chat.test/api/verify-email?token=") {
+			t.Fatalf("verification mail = %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no verification mail was sent")
+	}
+}
+
+func createToken(t *testing.T, conn *gorm.DB, userID uint) {
+	t.Helper()
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      "bot",
+		Prefix:    "pat_test",
+		TokenHash: utils.HashToken(time.Now().String()),
+		Scopes:    []string{models.ScopeChannelsRead},
+	}
+	if err := conn.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tokenCount(t *testing.T, conn *gorm.DB, userID uint) int64 {
+	t.Helper()
+	var n int64
+	if err := conn.Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRegisterReportsFieldErrors(t *testing.T) {
+	a, conn, _ := newTestAuth(t)
+
+	tests := []struct {
+		name    string
+		payload authPayload
+		want    map[string]string
+	}{
+		{
+			"every field",
+			authPayload{Name: "bob@example.com", Email: "Bob <bob@example.com>", Password: "short"},
+			map[string]string{
+				"name":     "must not contain @",
+				"email":    "is not a valid email address",
+				"password": "must be at least 8 characters",
+			},
+		},
+		{
+			"breached password",
+			authPayload{Name: "bob", Email: "bob@example.com", Password: "password"},
+			map[string]string{"password": "appears in a list of breached passwords"},
+		},
+		{
+			"password is the name",
+			authPayload{Name: "bob-smith", Email: "bob@example.com", Password: "BOB-SMITH"},
+			map[string]string{"password": "must not match your name or email"},
+		},
+		{
+			"password is the email",
+			authPayload{Name: "bob", Email: "bob@example.com", Password: "Bob@Example.com"},
+			map[string]string{"password": "must not match your name or email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(a.Register, http.MethodPost, "/api/register", tt.payload, 0)
+			assertStatus(t, w, http.StatusBadRequest)
+			body := decode(t, w)
+			if body["error"] != "validation failed" {
+				t.Fatalf("error = %v, want validation failed", body["error"])
+			}
+			fields, ok := body["fields"].(map[string]interface{})
+			if !ok || len(fields) != len(tt.want) {
+				t.Fatalf("fields = %v, want %v", body["fields"], tt.want)
+			}
+			for field, msg := range tt.want {
+				if fields[field] != msg {
+					t.Errorf("fields[%q] = %v, want %q", field, fields[field], msg)
+				}
+			}
+		})
+	}
+
+	var users int64
+	conn.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Fatalf("invalid registrations created %d users", users)
+	}
+}
+
+func TestCredentialChangesRevokeTokens(t *testing.T) {
+	t.Run("password change", func(t *testing.T) {
+		a, conn, _ := newTestAuth(t)
+		user := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com"})
+		other := createUser(t, conn, models.User{Username: "eve", Email: "eve@example.com"})
+		createToken(t, conn, user.ID)
+		createToken(t, conn, other.ID)
+
+		w := serve(a.UpdateMe, http.MethodPut, "/api/me", profileUpdatePayload{Name: "bobby"}, user.ID)
+		assertStatus(t, w, http.StatusOK)
+		if n := tokenCount(t, conn, user.ID); n != 1 {
+			t.Fatalf("tokens after a rename = %d, want 1", n)
+		}
+
+		w = serve(a.UpdateMe, http.MethodPut, "/api/me", profileUpdatePayload{Password: "a much better one"}, user.ID)
+		assertStatus(t, w, http.StatusOK)
+		if n := tokenCount(t, conn, user.ID); n != 0 {
+			t.Fatalf("tokens after a password change = %d, want 0", n)
+		}
+		if n := tokenCount(t, conn, other.ID); n != 1 {
+			t.Fatalf("another user's tokens = %d, want 1", n)
+		}
+	})
+
+	t.Run("password reset", func(t *testing.T) {
+		a, conn, _ := newTestAuth(t)
+		user := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com"})
+		createToken(t, conn, user.ID)
+		if err := conn.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken("reset-token"),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		w := serve(a.ResetPassword, http.MethodPost, "/api/password/reset", resetPasswordPayload{Token: "reset-token", Password: "a much better one"}, 0)
+		assertStatus(t, w, http.StatusOK)
+		if n := tokenCount(t, conn, user.ID); n != 0 {
+			t.Fatalf("tokens after a password reset = %d, want 0", n)
+		}
+	})
+}
@@ -1,18 +1,24 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
-	"strings"
+	"strconv"
 
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/logging"
 	"webFianlBackend/internal/middleware"
-	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/service"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/ws"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type ChannelController struct {
-	DB *gorm.DB
+	Audit    store.Audit
+	Channels *service.Channels
+	Manager  *ws.Manager
 }
 
 type channelPayload struct {
@@ -22,9 +28,9 @@ type channelPayload struct {
 func (cc *ChannelController) ListMine(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
 
-	var channels []models.Channel
-	if err := cc.DB.Where("owner_id = ?", userID).Preload("Owner").Find(&channels).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "list channels failed"})
+	channels, err := cc.Channels.Owned(c, userID)
+	if err != nil {
+		channelError(c, err, "list channels failed")
 		return
 	}
 
@@ -40,49 +46,25 @@ func (cc *ChannelController) Create(c *gin.Context) {
 		return
 	}
 
-	channel := models.Channel{
-		Name:    payload.Name,
-		OwnerID: userID,
-	}
-
-	if err := cc.DB.Create(&channel).Error; err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "channel already exists"})
+	channel, err := cc.Channels.Create(c, userID, payload.Name)
+	if err != nil {
+		channelError(c, err, "create channel failed")
 		return
 	}
 
-	_ = cc.DB.FirstOrCreate(&models.ChannelMember{}, models.ChannelMember{
+	audit.Record(cc.Audit, c, audit.Event{
+		Action:    audit.ActionChannelCreate,
 		ChannelID: channel.ID,
-		UserID:    userID,
+		Metadata:  map[string]interface{}{"name": channel.Name},
 	})
-
 	c.JSON(http.StatusCreated, channel)
 }
 
 // Search requires query format "owner@channel".
 func (cc *ChannelController) Search(c *gin.Context) {
-	query := c.Query("query")
-	if query == "" || !strings.Contains(query, "@") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query must be owner@channel"})
-		return
-	}
-
-	parts := strings.SplitN(query, "@", 2)
-	ownerName := parts[0]
-	channelName := parts[1]
-	if ownerName == "" || channelName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query must be owner@channel"})
-		return
-	}
-
-	var owner models.User
-	if err := cc.DB.Where("username = ?", ownerName).First(&owner).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "owner not found"})
-		return
-	}
-
-	var channel models.Channel
-	if err := cc.DB.Where("owner_id = ? AND name = ?", owner.ID, channelName).Preload("Owner").First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+	channel, err := cc.Channels.Search(c, c.Query("query"))
+	if err != nil {
+		channelError(c, err, "search channels failed")
 		return
 	}
 
@@ -92,13 +74,9 @@ func (cc *ChannelController) Search(c *gin.Context) {
 func (cc *ChannelController) ListJoined(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
 
-	var channels []models.Channel
-	if err := cc.DB.
-		Joins("JOIN channel_members ON channel_members.channel_id = channels.id").
-		Where("channel_members.user_id = ? AND channels.owner_id <> ?", userID, userID).
-		Preload("Owner").
-		Find(&channels).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "list joined channels failed"})
+	channels, err := cc.Channels.Joined(c, userID)
+	if err != nil {
+		channelError(c, err, "list joined channels failed")
 		return
 	}
 
@@ -107,71 +85,94 @@ func (cc *ChannelController) ListJoined(c *gin.Context) {
 
 func (cc *ChannelController) Join(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
-	channelID := c.Param("id")
 
-	var channel models.Channel
-	if err := cc.DB.Where("id = ?", channelID).Preload("Owner").First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+	channel, err := cc.Channels.Join(c, userID, channelParam(c))
+	if err != nil {
+		channelError(c, err, "join channel failed")
 		return
 	}
 
-	_ = cc.DB.FirstOrCreate(&models.ChannelMember{}, models.ChannelMember{
-		ChannelID: channel.ID,
-		UserID:    userID,
-	})
-
+	audit.Record(cc.Audit, c, audit.Event{Action: audit.ActionChannelJoin, ChannelID: channel.ID})
 	c.JSON(http.StatusOK, channel)
 }
 
 func (cc *ChannelController) ListMembers(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
-	channelID := c.Param("id")
 
-	var channel models.Channel
-	if err := cc.DB.Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+	members, err := cc.Channels.Members(c, userID, channelParam(c))
+	if err != nil {
+		channelError(c, err, "list members failed")
 		return
 	}
 
-	var membership models.ChannelMember
-	if err := cc.DB.Where("channel_id = ? AND user_id = ?", channel.ID, userID).First(&membership).Error; err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "not a member"})
-		return
-	}
+	c.JSON(http.StatusOK, members)
+}
+
+// ListOnline returns the members currently connected to the channel, on any
+// server instance.
+func (cc *ChannelController) ListOnline(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
 
-	var members []models.User
-	if err := cc.DB.Table("users").
-		Select("users.id, users.username, users.email, users.created_at").
-		Joins("JOIN channel_members ON channel_members.user_id = users.id").
-		Where("channel_members.channel_id = ?", channel.ID).
-		Order("users.username").
-		Find(&members).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "list members failed"})
+	users, err := cc.Channels.Online(c, userID, channelParam(c))
+	if err != nil {
+		channelError(c, err, "list online users failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, members)
+	online := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		online = append(online, gin.H{"id": user.ID, "name": user.Username})
+	}
+	c.JSON(http.StatusOK, online)
 }
 
 func (cc *ChannelController) Delete(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
-	channelID := c.Param("id")
 
-	var channel models.Channel
-	if err := cc.DB.Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
-		return
-	}
-	if channel.OwnerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "not the owner"})
+	channel, err := cc.Channels.Delete(c, userID, channelParam(c))
+	if err != nil {
+		channelError(c, err, "delete channel failed")
 		return
 	}
+	cc.Manager.CloseChannel(channel.ID, ws.CloseChannelDeleted, "channel deleted")
 
-	_ = cc.DB.Where("channel_id = ?", channel.ID).Delete(&models.ChannelMember{}).Error
-	if err := cc.DB.Delete(&channel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete channel failed"})
-		return
-	}
+	audit.Record(cc.Audit, c, audit.Event{
+		Action:    audit.ActionChannelDelete,
+		ChannelID: channel.ID,
+		Metadata:  map[string]interface{}{"name": channel.Name},
+	})
 
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
+
+// channelParam returns the :id parameter. Malformed IDs become 0, which
+// matches no channel.
+func channelParam(c *gin.Context) uint {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+	return uint(id)
+}
+
+// channelError responds to an error from service.Channels. The service's
+// own errors are shown as they are; anything else is logged and reported
+// as msg.
+func channelError(c *gin.Context, err error, msg string) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrInvalidQuery):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrChannelNotFound), errors.Is(err, service.ErrOwnerNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotOwner):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrChannelExists):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrPresenceUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": service.ErrPresenceUnavailable.Error()})
+		return
+	default:
+		logging.From(c).Error(msg, "error", err)
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
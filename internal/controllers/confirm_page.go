@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// confirmTemplate is what an emailed link opens. Following the link only
+// shows the page; the token is spent when the form is submitted, so mail
+// scanners and link prefetchers that fetch URLs cannot use it up.
+var confirmTemplate = template.Must(template.New("confirm").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{if .Token}}<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>
+{{else}}<p><a href="{{.AppURL}}">Continue to the chat</a></p>
+{{end}}</body>
+</html>
+`))
+
+type confirmView struct {
+	Title   string
+	Message string
+	// Token, Action and Button make up the form; without a token the page
+	// links back to AppURL instead.
+	Token  string
+	Action string
+	Button string
+	AppURL string
+}
+
+// renderConfirm serves the page for a link's GET: a form that posts the
+// token back to the same path.
+func (a *AuthController) renderConfirm(c *gin.Context, title, message, button string) {
+	token := c.Query("token")
+	if token == "" {
+		a.renderResult(c, http.StatusBadRequest, title, "This link is incomplete. Open the full link from the email.")
+		return
+	}
+	a.renderPage(c, http.StatusOK, confirmView{
+		Title:   title,
+		Message: message,
+		Token:   token,
+		Action:  c.Request.URL.Path,
+		Button:  button,
+	})
+}
+
+func (a *AuthController) renderResult(c *gin.Context, status int, title, message string) {
+	a.renderPage(c, status, confirmView{Title: title, Message: message, AppURL: a.AppURL})
+}
+
+func (a *AuthController) renderPage(c *gin.Context, status int, view confirmView) {
+	// The token must not leak to other sites through the Referer header.
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := confirmTemplate.Execute(c.Writer, view); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// fromForm reports whether the request was submitted by the confirmation
+// page rather than an API client.
+func fromForm(c *gin.Context) bool {
+	return c.ContentType() == "application/x-www-form-urlencoded"
+}
+
+// postedToken reads the token from the confirmation form or a JSON body.
+func postedToken(c *gin.Context) string {
+	if fromForm(c) {
+		return c.PostForm("token")
+	}
+	var payload struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		return ""
+	}
+	return payload.Token
+}
+
+// tokenResult answers a token submission with a page for the confirmation
+// form and with body as JSON for API clients.
+func (a *AuthController) tokenResult(c *gin.Context, status int, body gin.H, title, message string) {
+	if fromForm(c) {
+		a.renderResult(c, status, title, message)
+		return
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// submitForm posts values the way the confirmation page's form does.
+func submitForm(handler gin.HandlerFunc, target string, values url.Values) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler(c)
+	return w
+}
+
+func TestVerifyEmailLinkNeedsConfirmation(t *testing.T) {
+	a, conn, _ := newTestAuth(t)
+	user := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com"})
+	carol := createUser(t, conn, models.User{Username: "carol", Email: "carol@example.com"})
+	for raw, u := range map[string]models.User{"form-token": user, "json-token": carol} {
+		if err := conn.Create(&models.EmailVerification{
+			UserID: u.ID, Email: u.Email, TokenHash: utils.HashToken(raw), ExpiresAt: time.Now().Add(time.Hour),
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	verified := func() bool {
+		var got models.User
+		if err := conn.First(&got, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return got.EmailVerifiedAt != nil
+	}
+
+	// Following the link, as a mail scanner would, only shows the form.
+	w := serve(a.VerifyEmailPage, http.MethodGet, "/api/verify-email?token=form-token", nil, 0)
+	assertStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `name="token" value="form-token"`) || !strings.Contains(w.Body.String(), `action="/api/verify-email"`) {
+		t.Fatalf("page does not post the token back:\n%s", w.Body.String())
+	}
+	if verified() {
+		t.Fatal("opening the link verified the email")
+	}
+
+	w = submitForm(a.VerifyEmail, "/api/verify-email", url.Values{"token": {"form-token"}})
+	assertStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), "verified") || !verified() {
+		t.Fatalf("form submission did not verify: %s", w.Body.String())
+	}
+	w = submitForm(a.VerifyEmail, "/api/verify-email", url.Values{"token": {"form-token"}})
+	assertStatus(t, w, http.StatusBadRequest)
+
+	// API clients still post JSON; a query token alone no longer counts.
+	assertStatus(t, serve(a.VerifyEmail, http.MethodPost, "/api/verify-email?token=json-token", nil, 0), http.StatusBadRequest)
+	w = serve(a.VerifyEmail, http.MethodPost, "/api/verify-email", gin.H{"token": "json-token"}, 0)
+	assertStatus(t, w, http.StatusOK)
+	if status := decode(t, w)["status"]; status != "verified" {
+		t.Fatalf("status = %v, want verified", status)
+	}
+}
+
+func TestUnlockLinkNeedsConfirmation(t *testing.T) {
+	a, conn, _ := newTestAuth(t)
+	until := time.Now().Add(time.Hour)
+	user := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com", FailedLogins: 10, LockedUntil: &until})
+	if err := conn.Create(&models.AccountUnlock{
+		UserID: user.ID, TokenHash: utils.HashToken("unlock-token"), ExpiresAt: time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	locked := func() bool {
+		var got models.User
+		if err := conn.First(&got, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return got.LockedUntil != nil
+	}
+
+	assertStatus(t, serve(a.UnlockPage, http.MethodGet, "/api/unlock?token=unlock-token", nil, 0), http.StatusOK)
+	assertStatus(t, serve(a.UnlockPage, http.MethodGet, "/api/unlock", nil, 0), http.StatusBadRequest)
+	if !locked() {
+		t.Fatal("opening the link unlocked the account")
+	}
+
+	w := submitForm(a.Unlock, "/api/unlock", url.Values{"token": {"unlock-token"}})
+	assertStatus(t, w, http.StatusOK)
+	if locked() {
+		t.Fatalf("form submission did not unlock: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CookieOptions are the attributes shared by the cookies the API sets.
+// Secure is "auto" (only over TLS), "true" or "false"; a zero SameSite
+// means Lax.
+type CookieOptions struct {
+	Secure   string
+	Domain   string
+	SameSite http.SameSite
+}
+
+func (o CookieOptions) set(c *gin.Context, name, value string, maxAge int, path string) {
+	secure := c.Request.TLS != nil
+	switch o.Secure {
+	case "true":
+		secure = true
+	case "false":
+		secure = false
+	}
+	sameSite := o.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, value, maxAge, path, o.Domain, secure, true)
+}
+
+func (o CookieOptions) clear(c *gin.Context, name, path string) {
+	o.set(c, name, "", -1, path)
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"webFianlBackend/internal/db"
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// healthCheckTimeout bounds each dependency check in Ready.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthController answers orchestrator probes. CheckBroadcaster is set when
+// the broadcaster is shared between instances.
+type HealthController struct {
+	DB               *gorm.DB
+	Manager          *ws.Manager
+	CheckBroadcaster bool
+}
+
+type healthCheck struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Live reports that the process is up and serving requests.
+func (hc *HealthController) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready reports whether this instance should receive traffic, with the
+// result of each check. It answers 503 if any check fails or the server is
+// shutting down.
+func (hc *HealthController) Ready(c *gin.Context) {
+	checks := map[string]healthCheck{
+		"database": hc.check(c, "database", func(ctx context.Context) error {
+			sqlDB, err := hc.DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}),
+		"schema": hc.check(c, "schema", func(ctx context.Context) error {
+			return db.CheckSchema(ctx, hc.DB)
+		}),
+	}
+	if hc.CheckBroadcaster {
+		checks["broadcaster"] = hc.check(c, "broadcaster", hc.Manager.PingBroadcaster)
+	}
+
+	ready := true
+	for _, check := range checks {
+		if check.Status != "ok" {
+			ready = false
+		}
+	}
+	if hc.Manager.Draining() {
+		checks["shutdown"] = healthCheck{Status: "draining"}
+		ready = false
+	} else {
+		checks["shutdown"] = healthCheck{Status: "ok"}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+}
+
+// check runs fn with a timeout. Errors are logged but only described
+// generically in the response, since they may name internal hosts.
+func (hc *HealthController) check(c *gin.Context, name string, fn func(context.Context) error) healthCheck {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+	result := healthCheck{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		logging.From(c).Warn("readiness check failed", "check", name, "error", err)
+		result.Status = "error"
+		result.Error = "check failed"
+		var schemaErr *db.SchemaVersionError
+		if errors.As(err, &schemaErr) {
+			result.Error = schemaErr.Error()
+		}
+	}
+	return result
+}
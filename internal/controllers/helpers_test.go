@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/db"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/validation"
+	"webFianlBackend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestDB returns a migrated in-memory SQLite database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := db.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// recordingMailer hands every message to the test through sent.
+type recordingMailer struct {
+	sent chan mailer.Message
+}
+
+func (m recordingMailer) Send(_ context.Context, msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// newTestAuth returns an AuthController on a fresh database, which is
+// returned for inspection, whose mail is delivered to the returned channel.
+func newTestAuth(t *testing.T) (*AuthController, *gorm.DB, chan mailer.Message) {
+	t.Helper()
+	policy, err := validation.NewPolicy(validation.Config{
+		PasswordMinLength: 8,
+		PasswordMaxLength: 72,
+		UsernameMinLength: 3,
+		UsernameMaxLength: 32,
+		UsernamePattern:   `^[\p{L}\p{N}_.-]+$`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := ws.NewManager(ws.NewMemoryBroadcaster(), ws.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan mailer.Message, 16)
+	conn := newTestDB(t)
+	stores := store.NewGorm(conn)
+	return &AuthController{
+		Users:    stores.Users,
+		Accounts: stores.Accounts,
+		Logins:   stores.Logins,
+		Sessions: stores.Sessions,
+		Audit:    stores.Audit,
+		Keys:     utils.NewHMACKeySet("test"),
+		Policy:   policy,
+		Manager:  manager,
+		Mailer:   recordingMailer{sent: sent},
+		AppURL:   "http://chat.test",
+		TokenTTL: time.Hour,
+	}, conn, sent
+}
+
+// createUser stores a user whose password is "password".
+func createUser(t *testing.T, conn *gorm.DB, user models.User) models.User {
+	t.Helper()
+	hash, err := utils.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Password = hash
+	if err := conn.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// serve runs handler for a request with body encoded as JSON, signed in as
+// userID unless it is 0.
+func serve(handler gin.HandlerFunc, method, target string, body interface{}, userID uint) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, _ := json.Marshal(body)
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, reader)
+	c.Request.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		c.Set(middleware.ContextUserIDKey, userID)
+	}
+	handler(c)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %d %q is not JSON: %v", w.Code, w.Body.String(), err)
+	}
+	return body
+}
+
+// assertStatus fails unless w has the given status.
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d %s, want %d (%s)", w.Code, w.Body.String(), status, http.StatusText(status))
+	}
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"net/http"
+
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeysController publishes the token verification keys so other services
+// can validate tokens issued here.
+type KeysController struct {
+	Keys *utils.KeySet
+}
+
+func (kc *KeysController) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, kc.Keys.JWKS())
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-account login throttling. The first few failures are free; after that
+// each attempt must wait twice as long as the previous one, and reaching the
+// threshold locks the account for a while. Failures are forgotten once none
+// has happened for failedLoginWindow.
+const (
+	freeLoginAttempts = 3
+	maxLoginDelay     = time.Minute
+	lockoutThreshold  = 10
+	lockoutDuration   = 15 * time.Minute
+	failedLoginWindow = 15 * time.Minute
+	accountUnlockTTL  = 24 * time.Hour
+)
+
+// Reasons recorded with audit.ActionLoginFailed.
+const (
+	loginFailUnknownAccount = "unknown_account"
+	loginFailBadPassword    = "bad_password"
+	loginFailBadCode        = "bad_code"
+	loginFailThrottled      = "throttled"
+	loginFailLocked         = "locked"
+)
+
+func loginDelay(failures int) time.Duration {
+	if failures < freeLoginAttempts {
+		return 0
+	}
+	shift := failures - freeLoginAttempts
+	if shift > 6 {
+		return maxLoginDelay
+	}
+	delay := time.Second << shift
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
+
+// loginBlocked writes a 423 or 429 response and returns true when the account
+// is locked or still inside its back-off window.
+func (a *AuthController) loginBlocked(c *gin.Context, user models.User, identifier string) bool {
+	now := time.Now()
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		a.recordLoginAttempt(c, &user.ID, identifier, loginFailLocked)
+		respondLocked(c, *user.LockedUntil)
+		return true
+	}
+
+	if user.LastFailedLoginAt != nil {
+		retryAt := user.LastFailedLoginAt.Add(loginDelay(user.FailedLogins))
+		if now.Before(retryAt) {
+			a.recordLoginAttempt(c, &user.ID, identifier, loginFailThrottled)
+			wait := retryAfterSeconds(retryAt.Sub(now))
+			c.Header("Retry-After", strconv.Itoa(wait))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "too many failed attempts, try again later",
+				"retry_after": wait,
+			})
+			return true
+		}
+	}
+
+	return false
+}
+
+// loginFailed counts a wrong password or code against user, locks the account
+// when the threshold is reached, and writes the response. A failure after a
+// quiet failedLoginWindow starts the count again.
+func (a *AuthController) loginFailed(c *gin.Context, user models.User, identifier, reason, message string) {
+	a.recordLoginAttempt(c, &user.ID, identifier, reason)
+
+	now := time.Now()
+	failures, err := a.Logins.Failed(c, user.ID, now, failedLoginWindow)
+	if err != nil {
+		logging.From(c).Error("record failed login failed", "target_user_id", user.ID, "error", err)
+	} else if failures >= lockoutThreshold {
+		lockedUntil := now.Add(lockoutDuration)
+		if err := a.Logins.Lock(c, user.ID, lockedUntil); err == nil {
+			audit.Record(a.Audit, c, audit.Event{
+				Action:       audit.ActionLocked,
+				TargetUserID: user.ID,
+				Metadata:     map[string]interface{}{"locked_until": lockedUntil},
+			})
+			logger := logging.From(c)
+			go func() {
+				if err := a.sendUnlock(user, lockedUntil); err != nil {
+					logger.Error("send unlock link failed", "target_user_id", user.ID, "error", err)
+				}
+			}()
+			respondLocked(c, lockedUntil)
+			return
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// loginSucceeded clears the failure counters after a complete login.
+func (a *AuthController) loginSucceeded(c *gin.Context, user models.User) {
+	if user.FailedLogins == 0 && user.LockedUntil == nil && user.LastFailedLoginAt == nil {
+		return
+	}
+	if err := a.Logins.Succeeded(c, user.ID); err != nil {
+		logging.From(c).Error("reset failed logins failed", "target_user_id", user.ID, "error", err)
+	}
+}
+
+func (a *AuthController) recordLoginAttempt(c *gin.Context, userID *uint, identifier, reason string) {
+	var target uint
+	if userID != nil {
+		target = *userID
+	}
+	if len(identifier) > 255 {
+		identifier = identifier[:255]
+	}
+	audit.Record(a.Audit, c, audit.Event{
+		Action:       audit.ActionLoginFailed,
+		TargetUserID: target,
+		Metadata:     map[string]interface{}{"identifier": identifier, "reason": reason},
+	})
+}
+
+func respondLocked(c *gin.Context, lockedUntil time.Time) {
+	wait := retryAfterSeconds(time.Until(lockedUntil))
+	c.Header("Retry-After", strconv.Itoa(wait))
+	c.JSON(http.StatusLocked, gin.H{
+		"error":        "account temporarily locked after too many failed logins; check your email for an unlock link",
+		"locked_until": lockedUntil,
+		"retry_after":  wait,
+	})
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	secs := int(d.Round(time.Second).Seconds())
+	if secs < 1 {
+		return 1
+	}
+	return secs
+}
+
+func (a *AuthController) sendUnlock(user models.User, lockedUntil time.Time) error {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := a.Logins.AddUnlock(context.Background(), &models.AccountUnlock{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(accountUnlockTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/unlock?token=%s", a.AppURL, url.QueryEscape(raw))
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was locked until %s after too many failed sign-in attempts.\n\nIf that was you, open the link below to unlock it now:\n\n%s\n\nIf it was not you, consider resetting your password.\n",
+			user.Username, lockedUntil.Format(time.RFC1123), link),
+	})
+}
+
+// UnlockPage is what the link mailed on a lockout opens. It only asks the
+// user to confirm; Unlock spends the token.
+func (a *AuthController) UnlockPage(c *gin.Context) {
+	a.renderConfirm(c, "Unlock your account", "Unlock your account so you can sign in again right away.", "Unlock account")
+}
+
+// Unlock lifts a lockout using the token mailed when it happened. Like
+// VerifyEmail it accepts the token from the confirmation page or as a JSON
+// body.
+func (a *AuthController) Unlock(c *gin.Context) {
+	const title = "Unlock your account"
+	invalid := func() {
+		a.tokenResult(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"}, title, "This link is invalid or has expired. Wait for the lock to end or reset your password.")
+	}
+	token := postedToken(c)
+	if token == "" {
+		a.tokenResult(c, http.StatusBadRequest, gin.H{"error": "token is required"}, title, "This link is incomplete. Open the full link from the email.")
+		return
+	}
+
+	userID, err := a.Logins.UnlockUser(c, utils.HashToken(token))
+	if err != nil {
+		invalid()
+		return
+	}
+
+	if err := a.Logins.Unlock(c, userID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			invalid()
+			return
+		}
+		a.tokenResult(c, http.StatusInternalServerError, gin.H{"error": "unlock failed"}, title, "Something went wrong. Try again later.")
+		return
+	}
+
+	audit.Record(a.Audit, c, audit.Event{
+		Action:       audit.ActionUnlocked,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"method": "email"},
+	})
+	a.tokenResult(c, http.StatusOK, gin.H{"status": "unlocked"}, title, "Your account is unlocked. You can sign in again.")
+}
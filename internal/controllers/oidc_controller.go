@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowCookieName = "oidc_flow"
+	oidcFlowTTL        = 10 * time.Minute
+	oidcCookiePath     = "/api/auth/oidc"
+)
+
+// errOIDCEmailUnverified means a local account has the provider's email but
+// has never verified it, so whoever registered it may not own the address.
+var errOIDCEmailUnverified = errors.New("local account email is not verified")
+
+// OIDCController implements authorization-code-with-PKCE login against an
+// external OpenID Connect provider. Provider discovery happens on first use
+// so the server can start while the provider is unreachable.
+type OIDCController struct {
+	Auth         *AuthController
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	PostLoginURL string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func (oc *OIDCController) setup(ctx context.Context) (*oidc.Provider, oauth2.Config, error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if oc.provider == nil {
+		provider, err := oidc.NewProvider(ctx, oc.Issuer)
+		if err != nil {
+			return nil, oauth2.Config{}, err
+		}
+		oc.provider = provider
+	}
+
+	return oc.provider, oauth2.Config{
+		ClientID:     oc.ClientID,
+		ClientSecret: oc.ClientSecret,
+		RedirectURL:  oc.RedirectURL,
+		Endpoint:     oc.provider.Endpoint(),
+		Scopes:       oc.Scopes,
+	}, nil
+}
+
+// Login redirects the browser to the provider. State, nonce and the PKCE
+// verifier travel in a short-lived HttpOnly cookie scoped to the callback.
+func (oc *OIDCController) Login(c *gin.Context) {
+	_, oauthCfg, err := oc.setup(c.Request.Context())
+	if err != nil {
+		logging.From(c).Error("oidc discovery failed", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	state, err := utils.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	nonce, err := utils.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	oc.Auth.Cookies.set(c, oidcFlowCookieName, strings.Join([]string{state, nonce, verifier}, "."),
+		int(oidcFlowTTL.Seconds()), oidcCookiePath)
+
+	c.Redirect(http.StatusFound, oauthCfg.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(verifier),
+	))
+}
+
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+func (oc *OIDCController) Callback(c *gin.Context) {
+	flow, err := c.Cookie(oidcFlowCookieName)
+	oc.Auth.Cookies.clear(c, oidcFlowCookieName, oidcCookiePath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login flow expired"})
+		return
+	}
+	parts := strings.Split(flow, ".")
+	if len(parts) != 3 || c.Query("state") != parts[0] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid state"})
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login rejected by identity provider", "reason": errCode})
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider, oauthCfg, err := oc.setup(ctx)
+	if err != nil {
+		logging.From(c).Error("oidc discovery failed", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+
+	token, err := oauthCfg.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "code exchange failed"})
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing id_token"})
+		return
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oc.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != nonce {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id_token"})
+		return
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id_token"})
+		return
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "identity provider did not return a verified email"})
+		return
+	}
+
+	user, err := oc.resolveUser(c, idToken.Issuer, claims)
+	if errors.Is(err, errOIDCEmailUnverified) {
+		c.JSON(http.StatusConflict, gin.H{"error": "an account with this email exists; sign in with its password and verify the email before using single sign-on"})
+		return
+	}
+	if err != nil {
+		logging.From(c).Error("oidc user resolution failed", "issuer", idToken.Issuer, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account suspended"})
+		return
+	}
+
+	// Local TOTP is not asked for here: the identity provider is responsible
+	// for any second factor.
+	if err := oc.Auth.startSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		return
+	}
+	audit.Record(oc.Auth.Audit, c, audit.Event{
+		Action:    audit.ActionLogin,
+		ActorID:   user.ID,
+		ActorName: user.Username,
+		Metadata:  map[string]interface{}{"method": "oidc", "issuer": idToken.Issuer},
+	})
+
+	c.Redirect(http.StatusFound, oc.PostLoginURL)
+}
+
+// resolveUser finds the user linked to the provider identity, links an
+// existing user with the same verified email, or creates a new user. An
+// existing user whose email is unverified is not linked: the address may have
+// been registered by someone else, whose password would then open the
+// account.
+func (oc *OIDCController) resolveUser(ctx context.Context, issuer string, claims oidcClaims) (models.User, error) {
+	user, err := oc.Auth.Accounts.ByIdentity(ctx, issuer, claims.Subject)
+	if !errors.Is(err, store.ErrNotFound) {
+		return user, err
+	}
+
+	user, err = oc.Auth.Users.ByEmail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		user, err = oc.newUser(ctx, claims)
+	case err == nil && user.EmailVerifiedAt == nil:
+		return models.User{}, errOIDCEmailUnverified
+	}
+	if err != nil {
+		return user, err
+	}
+
+	err = oc.Auth.Accounts.Link(ctx, &user, &models.UserIdentity{Issuer: issuer, Subject: claims.Subject})
+	return user, err
+}
+
+// newUser prepares, without storing it, a user for claims. The account can
+// only be used through the provider until the user sets a password via the
+// reset flow.
+func (oc *OIDCController) newUser(ctx context.Context, claims oidcClaims) (models.User, error) {
+	username, err := oc.uniqueUsername(ctx, claims)
+	if err != nil {
+		return models.User{}, err
+	}
+	unusable, err := utils.RandomToken(32)
+	if err != nil {
+		return models.User{}, err
+	}
+	hash, err := utils.HashPassword(unusable)
+	if err != nil {
+		return models.User{}, err
+	}
+	now := time.Now()
+	return models.User{
+		Username:        username,
+		Email:           claims.Email,
+		Password:        hash,
+		EmailVerifiedAt: &now,
+	}, nil
+}
+
+// uniqueUsername derives a free username that satisfies the username policy
+// from the provider claims.
+func (oc *OIDCController) uniqueUsername(ctx context.Context, claims oidcClaims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for i := 2; i < 100; i++ {
+		if oc.Auth.Policy.Username(candidate) != "" {
+			candidate = fmt.Sprintf("%s%d", base, i)
+			continue
+		}
+		_, err := oc.Auth.Users.ByUsername(ctx, candidate)
+		if errors.Is(err, store.ErrNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+
+	suffix, err := utils.RandomToken(4)
+	if err != nil {
+		return "", err
+	}
+	return base + "_" + suffix, nil
+}
+
+func sanitizeUsername(raw string) string {
+	var b strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		}
+		if b.Len() >= 24 {
+			break
+		}
+	}
+	return b.String()
+}
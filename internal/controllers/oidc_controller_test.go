@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// fakeProvider is an OpenID Connect provider that issues one ID token per
+// authorization code and checks the PKCE verifier on exchange.
+type fakeProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+// fakeGrant is what the provider remembers about an authorization code.
+type fakeGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+const fakeClientID = "chat-app"
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{t: t, key: key, codes: make(map[string]fakeGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.srv.URL,
+			"authorization_endpoint":                p.srv.URL + "/authorize",
+			"token_endpoint":                        p.srv.URL + "/token",
+			"jwks_uri":                              p.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		encode := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+			"n": encode(key.N.Bytes()),
+			"e": encode(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.srv = httptest.NewServer(mux)
+	t.Cleanup(p.srv.Close)
+	return p
+}
+
+// authorize plays the user approving the login at authURL and returns the
+// code the provider redirects back with. The ID token will carry claims
+// plus the standard ones.
+func (p *fakeProvider) authorize(authURL string, claims jwt.MapClaims) (state, code string) {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization request without S256 PKCE: %s", authURL)
+	}
+	if q.Get("client_id") != fakeClientID || q.Get("nonce") == "" {
+		p.t.Fatalf("authorization request = %s", authURL)
+	}
+
+	now := time.Now()
+	full := jwt.MapClaims{
+		"iss":   p.srv.URL,
+		"aud":   fakeClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	code = "code-" + q.Get("state")
+	p.mu.Lock()
+	p.codes[code] = fakeGrant{challenge: q.Get("code_challenge"), claims: full}
+	p.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	grant, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func newTestOIDC(t *testing.T) (*OIDCController, *gorm.DB, *fakeProvider) {
+	t.Helper()
+	a, conn, _ := newTestAuth(t)
+	p := newFakeProvider(t)
+	return &OIDCController{
+		Auth:         a,
+		Issuer:       p.srv.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://chat.test/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		PostLoginURL: "http://chat.test/",
+	}, conn, p
+}
+
+// startOIDC runs Login and returns the provider URL it redirected to and
+// the flow cookie it set.
+func startOIDC(t *testing.T, oc *OIDCController) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil)
+	oc.Login(c)
+	assertStatus(t, w, http.StatusFound)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcFlowCookieName {
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("Login set no flow cookie")
+	return "", nil
+}
+
+func callbackOIDC(oc *OIDCController, flow *http.Cookie, state, code string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	query := url.Values{"state": {state}, "code": {code}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+query.Encode(), nil)
+	if flow != nil {
+		c.Request.AddCookie(flow)
+	}
+	oc.Callback(c)
+	return w
+}
+
+func hasAuthCookie(w *httptest.ResponseRecorder) bool {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == authCookieName && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	oc, conn, p := newTestOIDC(t)
+	authURL, flow := startOIDC(t, oc)
+	state, code := p.authorize(authURL, jwt.MapClaims{
+		"sub": "alice-1", "email": "Alice@Example.com", "email_verified": true, "preferred_username": "alice",
+	})
+
+	w := callbackOIDC(oc, flow, state, code)
+	assertStatus(t, w, http.StatusFound)
+	if w.Header().Get("Location") != oc.PostLoginURL || !hasAuthCookie(w) {
+		t.Fatalf("callback redirected to %q, auth cookie %v", w.Header().Get("Location"), hasAuthCookie(w))
+	}
+
+	var user models.User
+	if err := conn.Where("email_normalized = ?", "alice@example.com").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" || user.EmailVerifiedAt == nil {
+		t.Fatalf("created user = %+v", user)
+	}
+	var identity models.UserIdentity
+	if err := conn.Where("issuer = ? AND subject = ?", p.srv.URL, "alice-1").First(&identity).Error; err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v", identity, err)
+	}
+
+	// A second login resolves the same user through the identity.
+	authURL, flow = startOIDC(t, oc)
+	state, code = p.authorize(authURL, jwt.MapClaims{"sub": "alice-1", "email": "alice@example.com", "email_verified": true})
+	assertStatus(t, callbackOIDC(oc, flow, state, code), http.StatusFound)
+	var users int64
+	conn.Model(&models.User{}).Count(&users)
+	if users != 1 {
+		t.Fatalf("users after a second login = %d, want 1", users)
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	oc, conn, p := newTestOIDC(t)
+	verified := time.Now().Add(-time.Hour)
+	existing := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com", EmailVerifiedAt: &verified})
+
+	authURL, flow := startOIDC(t, oc)
+	state, code := p.authorize(authURL, jwt.MapClaims{
+		"sub": "bob-1", "email": "BOB@example.com", "email_verified": true, "preferred_username": "robert",
+	})
+	assertStatus(t, callbackOIDC(oc, flow, state, code), http.StatusFound)
+
+	var identity models.UserIdentity
+	if err := conn.Where("subject = ?", "bob-1").First(&identity).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != existing.ID {
+		t.Fatalf("identity linked to user %d, want the existing %d", identity.UserID, existing.ID)
+	}
+	var user models.User
+	if err := conn.First(&user, existing.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "bob" {
+		t.Fatalf("linked user = %+v, want bob", user)
+	}
+}
+
+func TestOIDCCallbackDoesNotLinkUnverifiedLocalEmail(t *testing.T) {
+	oc, conn, p := newTestOIDC(t)
+	// Anyone could have registered this address; linking would hand the
+	// victim's SSO login an account whose password the registrant knows.
+	existing := createUser(t, conn, models.User{Username: "squatter", Email: "bob@example.com"})
+
+	authURL, flow := startOIDC(t, oc)
+	state, code := p.authorize(authURL, jwt.MapClaims{"sub": "bob-1", "email": "bob@example.com", "email_verified": true})
+	w := callbackOIDC(oc, flow, state, code)
+	assertStatus(t, w, http.StatusConflict)
+	if hasAuthCookie(w) {
+		t.Fatal("an unverified local account got an SSO session")
+	}
+
+	var identities int64
+	conn.Model(&models.UserIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Fatalf("identities = %d, want none", identities)
+	}
+	var user models.User
+	if err := conn.First(&user, existing.ID).Error; err != nil || user.EmailVerifiedAt != nil {
+		t.Fatalf("existing user = %+v, %v; want it untouched", user, err)
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	oc, conn, p := newTestOIDC(t)
+	existing := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com"})
+
+	authURL, flow := startOIDC(t, oc)
+	state, code := p.authorize(authURL, jwt.MapClaims{"sub": "mallory", "email": "bob@example.com", "email_verified": false})
+	w := callbackOIDC(oc, flow, state, code)
+	assertStatus(t, w, http.StatusForbidden)
+	if hasAuthCookie(w) {
+		t.Fatal("an unverified email got a session")
+	}
+
+	var identities int64
+	conn.Model(&models.UserIdentity{}).Count(&identities)
+	if identities != 0 {
+		t.Fatalf("identities = %d, want none", identities)
+	}
+	var user models.User
+	if err := conn.First(&user, existing.ID).Error; err != nil || user.EmailVerifiedAt != nil {
+		t.Fatalf("existing user = %+v, %v; want it untouched", user, err)
+	}
+}
+
+func TestOIDCCallbackChecksFlow(t *testing.T) {
+	oc, conn, p := newTestOIDC(t)
+	claims := jwt.MapClaims{"sub": "alice-1", "email": "alice@example.com", "email_verified": true}
+
+	t.Run("missing cookie", func(t *testing.T) {
+		authURL, _ := startOIDC(t, oc)
+		state, code := p.authorize(authURL, claims)
+		assertStatus(t, callbackOIDC(oc, nil, state, code), http.StatusBadRequest)
+	})
+
+	t.Run("wrong state", func(t *testing.T) {
+		authURL, flow := startOIDC(t, oc)
+		_, code := p.authorize(authURL, claims)
+		assertStatus(t, callbackOIDC(oc, flow, "forged", code), http.StatusBadRequest)
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		authURL, flow := startOIDC(t, oc)
+		state, code := p.authorize(authURL, claims)
+		// Another login's cookie has the same shape but its own verifier.
+		_, other := startOIDC(t, oc)
+		tampered := *flow
+		tampered.Value = state + "." + splitFlow(t, flow)[1] + "." + splitFlow(t, other)[2]
+		w := callbackOIDC(oc, &tampered, state, code)
+		assertStatus(t, w, http.StatusUnauthorized)
+		if message := decode(t, w)["error"]; message != "code exchange failed" {
+			t.Fatalf("error = %v, want code exchange failed", message)
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		authURL, flow := startOIDC(t, oc)
+		forged := jwt.MapClaims{"nonce": "replayed"}
+		for k, v := range claims {
+			forged[k] = v
+		}
+		state, code := p.authorize(authURL, forged)
+		w := callbackOIDC(oc, flow, state, code)
+		assertStatus(t, w, http.StatusUnauthorized)
+		if message := decode(t, w)["error"]; message != "invalid id_token" {
+			t.Fatalf("error = %v, want invalid id_token", message)
+		}
+	})
+
+	var users int64
+	conn.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Fatalf("users = %d after rejected callbacks, want none", users)
+	}
+}
+
+// splitFlow returns the state, nonce and verifier in a flow cookie.
+func splitFlow(t *testing.T, flow *http.Cookie) []string {
+	t.Helper()
+	parts := strings.SplitN(flow.Value, ".", 3)
+	if len(parts) != 3 {
+		t.Fatalf("malformed flow cookie %q", flow.Value)
+	}
+	return parts
+}
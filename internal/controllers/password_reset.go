@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+const passwordResetTTL = time.Hour
+
+var errResetTokenInvalid = errors.New("invalid or expired token")
+
+type forgotPasswordPayload struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ForgotPassword mails a reset link. The response is the same whether or not
+// the address belongs to an account, and mail is sent in the background so
+// response timing does not reveal it either.
+func (a *AuthController) ForgotPassword(c *gin.Context) {
+	var payload forgotPasswordPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	if user, err := a.Users.ByEmail(c, payload.Email); err == nil {
+		logger := logging.From(c)
+		go func() {
+			if err := a.sendPasswordReset(user); err != nil {
+				logger.Error("send password reset failed", "target_user_id", user.ID, "error", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "if the account exists, a reset link has been sent"})
+}
+
+func (a *AuthController) sendPasswordReset(user models.User) error {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	reset := models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := a.Accounts.AddPasswordReset(context.Background(), &reset); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", a.AppURL, url.QueryEscape(raw))
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open the link below:\n\n%s\n\nThe link expires in %d minutes and can be used once. If you did not ask for this, you can ignore this email.\n",
+			user.Username, link, int(passwordResetTTL.Minutes())),
+	})
+}
+
+type resetPasswordPayload struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ResetPassword consumes a reset token, sets the new password and signs the
+// account out everywhere, revoking its personal access tokens too.
+func (a *AuthController) ResetPassword(c *gin.Context) {
+	var payload resetPasswordPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	tokenHash := utils.HashToken(payload.Token)
+	user, err := a.Accounts.PasswordResetUser(c, tokenHash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errResetTokenInvalid.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset password failed"})
+		return
+	}
+	if msg := a.Policy.Password(payload.Password, user.Username, user.Email); msg != "" {
+		respondInvalid(c, validation.FieldErrors{"password": msg})
+		return
+	}
+	hash, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "password hash failed"})
+		return
+	}
+
+	// The token is checked again: another request may have used it while
+	// the password was hashed.
+	user, sessionIDs, err := a.Accounts.ResetPassword(c, tokenHash, hash)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errResetTokenInvalid.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "reset password failed"})
+		return
+	}
+
+	a.Manager.DisconnectSessions(sessionIDs...)
+	audit.Record(a.Audit, c, audit.Event{Action: audit.ActionPasswordReset, TargetUserID: user.ID})
+	c.JSON(http.StatusOK, gin.H{"status": "password_reset"})
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	Sessions store.Sessions
+	Audit    store.Audit
+	Manager  *ws.Manager
+	Cookies  CookieOptions
+}
+
+type sessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func (sc *SessionController) List(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+	currentID := c.GetString(middleware.ContextSessionIDKey)
+
+	sessions, err := sc.Sessions.Active(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list sessions failed"})
+		return
+	}
+
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{
+			Session: session,
+			Current: session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (sc *SessionController) Revoke(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+	sessionID := c.Param("id")
+
+	if err := sc.Sessions.Delete(c, userID, sessionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke session failed"})
+		return
+	}
+
+	sc.Manager.DisconnectSessions(sessionID)
+	audit.Record(sc.Audit, c, audit.Event{Action: audit.ActionSessionRevoke, TargetUserID: userID, Metadata: map[string]interface{}{"count": 1}})
+	if sessionID == c.GetString(middleware.ContextSessionIDKey) {
+		sc.Cookies.clear(c, authCookieName, "/")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+// RevokeOthers logs the user out everywhere except the current session.
+func (sc *SessionController) RevokeOthers(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+	currentID := c.GetString(middleware.ContextSessionIDKey)
+
+	sessionIDs, err := sc.Sessions.DeleteOthers(c, userID, currentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke sessions failed"})
+		return
+	}
+
+	sc.Manager.DisconnectSessions(sessionIDs...)
+	if len(sessionIDs) > 0 {
+		audit.Record(sc.Audit, c, audit.Event{Action: audit.ActionSessionRevoke, TargetUserID: userID, Metadata: map[string]interface{}{"count": len(sessionIDs)}})
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "revoked", "revoked": len(sessionIDs)})
+}
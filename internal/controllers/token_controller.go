@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/ws"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenController manages personal access tokens for bots and scripts.
+type TokenController struct {
+	Tokens  store.Tokens
+	Audit   store.Audit
+	Manager *ws.Manager
+}
+
+type tokenPayload struct {
+	Name      string     `json:"name" binding:"required,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (tc *TokenController) List(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	tokens, err := tc.Tokens.List(c, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list tokens failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Create returns the plaintext token exactly once; only its hash is stored.
+func (tc *TokenController) Create(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	var payload tokenPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	for _, scope := range payload.Scopes {
+		if !isTokenScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope, "scopes": models.TokenScopes})
+			return
+		}
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		return
+	}
+	raw := middleware.PersonalTokenPrefix + secret
+
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      payload.Name,
+		Prefix:    raw[:len(middleware.PersonalTokenPrefix)+8],
+		TokenHash: utils.HashToken(raw),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := tc.Tokens.Create(c, &token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "create token failed"})
+		return
+	}
+
+	audit.Record(tc.Audit, c, audit.Event{
+		Action:       audit.ActionTokenCreate,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"token_id": token.ID, "name": token.Name, "scopes": token.Scopes},
+	})
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "personal_access_token": token})
+}
+
+func (tc *TokenController) Revoke(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	token, err := tc.Tokens.Delete(c, userID, uint(id))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "revoke token failed"})
+		return
+	}
+
+	tc.Manager.DisconnectSessions(token.SessionKey())
+	audit.Record(tc.Audit, c, audit.Event{
+		Action:       audit.ActionTokenRevoke,
+		TargetUserID: userID,
+		Metadata:     map[string]interface{}{"token_id": token.ID, "name": token.Name},
+	})
+	c.JSON(http.StatusOK, gin.H{"status": "revoked"})
+}
+
+func isTokenScope(scope string) bool {
+	for _, s := range models.TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"webFianlBackend/internal/audit"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const recoveryCodeCount = 10
+
+func (a *AuthController) EnrollTwoFactor(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "secret generation failed"})
+		return
+	}
+	if err := a.Logins.SetTOTPSecret(c, user.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enroll failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    utils.TOTPURI(a.TOTPIssuer, user.Username, secret),
+	})
+}
+
+type twoFactorCodePayload struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their authenticator
+// produces valid codes, and returns the one-time recovery codes.
+func (a *AuthController) ConfirmTwoFactor(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	var payload twoFactorCodePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "enrollment not started"})
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, payload.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enable two-factor failed"})
+		return
+	}
+	if err := a.Logins.EnableTwoFactor(c, user.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enable two-factor failed"})
+		return
+	}
+
+	audit.Record(a.Audit, c, audit.Event{Action: audit.ActionTwoFactorEnable, TargetUserID: user.ID})
+	c.JSON(http.StatusOK, gin.H{"status": "enabled", "recovery_codes": codes})
+}
+
+type disableTwoFactorPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func (a *AuthController) DisableTwoFactor(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	var payload disableTwoFactorPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if !utils.CheckPassword(user.Password, payload.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	if err := a.Logins.DisableTwoFactor(c, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "disable two-factor failed"})
+		return
+	}
+
+	audit.Record(a.Audit, c, audit.Event{Action: audit.ActionTwoFactorDisable, TargetUserID: user.ID})
+	c.JSON(http.StatusOK, gin.H{"status": "disabled"})
+}
+
+type twoFactorLoginPayload struct {
+	PendingToken string `json:"pending_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// LoginTwoFactor exchanges the pending token from Login plus a TOTP or
+// recovery code for a real session.
+func (a *AuthController) LoginTwoFactor(c *gin.Context) {
+	var payload twoFactorLoginPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if payload.Code == "" && payload.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	claims, err := utils.ParseToken(payload.PendingToken, a.Keys)
+	if err != nil || claims.Purpose != utils.PurposeTwoFactor {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired pending token"})
+		return
+	}
+
+	user, err := a.Users.ByID(c, claims.UserID)
+	if err != nil ||
+		user.TokenVersion != claims.Version || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired pending token"})
+		return
+	}
+
+	if a.loginBlocked(c, user, user.Username) {
+		return
+	}
+
+	method := "totp"
+	if payload.Code != "" {
+		step, ok := utils.ValidateTOTP(user.TOTPSecret, payload.Code, time.Now())
+		if !ok {
+			a.loginFailed(c, user, user.Username, loginFailBadCode, "invalid code")
+			return
+		}
+		fresh, err := a.Logins.UseTOTPStep(c, user.ID, step)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "verify code failed"})
+			return
+		}
+		if !fresh {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "code already used"})
+			return
+		}
+	} else {
+		method = "recovery_code"
+		hash := utils.HashToken(normalizeRecoveryCode(payload.RecoveryCode))
+		used, err := a.Logins.UseRecoveryCode(c, user.ID, hash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "verify code failed"})
+			return
+		}
+		if !used {
+			a.loginFailed(c, user, user.Username, loginFailBadCode, "invalid recovery code")
+			return
+		}
+	}
+
+	if err := a.startSession(c, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token generation failed"})
+		return
+	}
+	a.loginSucceeded(c, user)
+	audit.Record(a.Audit, c, audit.Event{
+		Action:    audit.ActionLogin,
+		ActorID:   user.ID,
+		ActorName: user.Username,
+		Metadata:  map[string]interface{}{"method": method},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// newRecoveryCodes returns a fresh set of recovery codes for the user and
+// the hashes to store in their place.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes = make([]string, 0, recoveryCodeCount)
+	hashes = make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.RandomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
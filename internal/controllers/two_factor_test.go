@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+)
+
+func TestLoginTwoFactorRejectsReplayedCodes(t *testing.T) {
+	a, conn, _ := newTestAuth(t)
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createUser(t, conn, models.User{Username: "bob", Email: "bob@example.com", TOTPSecret: secret, TOTPEnabled: true})
+
+	login := func(code string) (int, string) {
+		t.Helper()
+		pending, err := utils.GenerateTwoFactorToken(user.ID, user.TokenVersion, a.Keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := serve(a.LoginTwoFactor, http.MethodPost, "/api/login/2fa", twoFactorLoginPayload{PendingToken: pending, Code: code}, 0)
+		message, _ := decode(t, w)["error"].(string)
+		return w.Code, message
+	}
+
+	now := time.Now()
+	current, err := utils.TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := utils.TOTPCode(secret, now.Add(-30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, message := login(current); status != http.StatusOK {
+		t.Fatalf("first use of the code = %d %q, want 200", status, message)
+	}
+	var stored models.User
+	if err := conn.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := now.Unix() / 30; stored.TOTPLastStep < want {
+		t.Fatalf("totp_last_step = %d, want at least %d", stored.TOTPLastStep, want)
+	}
+
+	// The same code again, and the previous step's code that is still
+	// inside the skew window, are at or before totp_last_step.
+	for _, code := range []string{current, previous} {
+		if status, message := login(code); status != http.StatusUnauthorized || message != "code already used" {
+			t.Errorf("replay of %s = %d %q, want 401 code already used", code, status, message)
+		}
+	}
+
+	var sessions int64
+	if err := conn.Model(&models.Session{}).Where("user_id = ?", user.ID).Count(&sessions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 1 {
+		t.Fatalf("sessions = %d, want 1", sessions)
+	}
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	mailSendTimeout      = 10 * time.Second
+)
+
+// sendVerification issues a fresh verification token for the user's current
+// email and mails the link. Pending tokens from earlier requests are dropped.
+func (a *AuthController) sendVerification(user models.User) error {
+	raw, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Accounts.AddVerification(context.Background(), &models.EmailVerification{
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/verify-email?token=%s", a.AppURL, url.QueryEscape(raw))
+	ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+	defer cancel()
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.Username, link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+// sendVerificationAsync runs sendVerification in the background, so a slow
+// mail server does not hold up the request; failures are only logged.
+func (a *AuthController) sendVerificationAsync(c *gin.Context, user models.User) {
+	logger := logging.From(c)
+	go func() {
+		if err := a.sendVerification(user); err != nil {
+			logger.Error("send verification failed", "target_user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+// VerifyEmailPage is what the emailed link opens. It only asks the user to
+// confirm; VerifyEmail spends the token.
+func (a *AuthController) VerifyEmailPage(c *gin.Context) {
+	a.renderConfirm(c, "Verify your email", "Confirm that this address belongs to your account.", "Verify email")
+}
+
+// VerifyEmail accepts the token from the confirmation page or as a JSON body.
+func (a *AuthController) VerifyEmail(c *gin.Context) {
+	const title = "Verify your email"
+	token := postedToken(c)
+	if token == "" {
+		a.tokenResult(c, http.StatusBadRequest, gin.H{"error": "token is required"}, title, "This link is incomplete. Open the full link from the email.")
+		return
+	}
+
+	_, err := a.Accounts.VerifyEmail(c, utils.HashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		a.tokenResult(c, http.StatusBadRequest, gin.H{"error": "invalid or expired token"}, title, "This link is invalid or has expired. Request a new one from your account settings.")
+		return
+	}
+	if err != nil {
+		a.tokenResult(c, http.StatusInternalServerError, gin.H{"error": "verify email failed"}, title, "Something went wrong. Try again later.")
+		return
+	}
+
+	a.tokenResult(c, http.StatusOK, gin.H{"status": "verified"}, title, "Your email address is verified.")
+}
+
+func (a *AuthController) ResendVerification(c *gin.Context) {
+	userID := c.GetUint(middleware.ContextUserIDKey)
+
+	user, err := a.Users.ByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "email already verified"})
+		return
+	}
+
+	if err := a.sendVerification(user); err != nil {
+		logging.From(c).Error("send verification failed", "target_user_id", user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "send verification failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "sent"})
+}
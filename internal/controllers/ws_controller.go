@@ -1,21 +1,23 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"webFianlBackend/internal/logging"
 	"webFianlBackend/internal/middleware"
-	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/service"
 	"webFianlBackend/internal/ws"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type WSController struct {
-	DB      *gorm.DB
-	Manager *ws.Manager
+	Channels       *service.Channels
+	Manager        *ws.Manager
 	AllowedOrigins map[string]bool
 }
 
@@ -27,6 +29,7 @@ var upgrader = websocket.Upgrader{
 func (wc *WSController) Serve(c *gin.Context) {
 	userID := c.GetUint(middleware.ContextUserIDKey)
 	username := c.GetString(middleware.ContextUsernameKey)
+	sessionID := c.GetString(middleware.ContextSessionIDKey)
 
 	channelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
@@ -34,18 +37,22 @@ func (wc *WSController) Serve(c *gin.Context) {
 		return
 	}
 
-	var channel models.Channel
-	if err := wc.DB.Where("id = ?", channelID).First(&channel).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+	if _, err := wc.Channels.Access(c, userID, uint(channelID)); err != nil {
+		channelError(c, err, "channel lookup failed")
 		return
 	}
 
-	if channel.OwnerID != userID {
-		var membership models.ChannelMember
-		if err := wc.DB.Where("channel_id = ? AND user_id = ?", channel.ID, userID).First(&membership).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "not a member"})
-			return
-		}
+	// The hub is fetched before upgrading so a node that cannot serve the
+	// channel answers with a plain 503.
+	hub, err := wc.Manager.Get(c.Request.Context(), uint(channelID))
+	if errors.Is(err, ws.ErrShuttingDown) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server shutting down"})
+		return
+	}
+	if err != nil {
+		logging.From(c).Error("websocket hub unavailable", "channel_id", channelID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "chat temporarily unavailable"})
+		return
 	}
 
 	upgrader.CheckOrigin = func(r *http.Request) bool {
@@ -58,15 +65,23 @@ func (wc *WSController) Serve(c *gin.Context) {
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		hub.Release()
 		return
 	}
 
-	hub := wc.Manager.Get(uint(channelID))
-	client := ws.NewClient(hub, conn, username)
-	hub.Register(client)
+	client := ws.NewClient(hub, conn, ws.Peer{
+		UserID:     userID,
+		Username:   username,
+		SessionID:  sessionID,
+		RemoteAddr: c.ClientIP(),
+		Logger:     logging.From(c),
+		Span:       trace.SpanContextFromContext(c.Request.Context()),
+	})
+	if err := hub.Register(c.Request.Context(), client); err != nil {
+		conn.Close()
+		return
+	}
 
 	go client.WritePump()
 	client.ReadPump()
-
-	_ = userID
 }
@@ -1,81 +1,56 @@
 package db
 
 import (
-	"database/sql"
 	"fmt"
-	"log"
-	"os"
-	"strings"
+	"log/slog"
+	"time"
 
-	"github.com/go-sql-driver/mysql"
-	gormmysql "gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	gormtracing "gorm.io/plugin/opentelemetry/tracing"
 )
 
-func Init(dsn string) *gorm.DB {
-	if err := ensureDatabase(dsn); err != nil {
-		log.Fatalf("db create failed: %v", err)
-	}
-
-	conn, err := gorm.Open(gormmysql.Open(dsn), &gorm.Config{})
+// Open connects to the database, creating it if it does not exist. driver
+// is mysql, postgres or sqlite. The schema is left alone; see Migrator.
+func Open(driver, dsn string) (*gorm.DB, error) {
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+	if err := d.ensureDatabase(dsn); err != nil {
+		return nil, fmt.Errorf("db create failed: %w", err)
+	}
+
+	conn, err := gorm.Open(d.open(dsn), &gorm.Config{
+		// Unique key violations come back as gorm.ErrDuplicatedKey.
+		TranslateError: true,
+		Logger: logger.New(slogWriter{}, logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	})
 	if err != nil {
-		log.Fatalf("db open failed: %v", err)
+		return nil, fmt.Errorf("db open failed: %w", err)
 	}
-
-	if err := applySchema(conn, "schema.sql"); err != nil {
-		log.Fatalf("db schema failed: %v", err)
-	}
-
-	return conn
-}
-
-func applySchema(conn *gorm.DB, path string) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return err
+	// Bound parameters are left out of spans: they include password hashes
+	// and tokens.
+	if err := conn.Use(gormtracing.NewPlugin(gormtracing.WithoutQueryVariables(), gormtracing.WithoutMetrics())); err != nil {
+		return nil, fmt.Errorf("db tracing failed: %w", err)
 	}
-
-	statements := strings.Split(string(data), ";")
-	for _, stmt := range statements {
-		trimmed := strings.TrimSpace(stmt)
-		if trimmed == "" {
-			continue
-		}
-		if err := conn.Exec(trimmed).Error; err != nil {
-			return err
+	if d.configure != nil {
+		if err := d.configure(conn, dsn); err != nil {
+			return nil, fmt.Errorf("db setup failed: %w", err)
 		}
 	}
 
-	return nil
+	return conn, nil
 }
 
-func ensureDatabase(dsn string) error {
-	cfg, err := mysql.ParseDSN(dsn)
-	if err != nil {
-		return err
-	}
-
-	dbName := cfg.DBName
-	if dbName == "" {
-		return nil
-	}
-
-	cfg.DBName = ""
-	adminDSN := cfg.FormatDSN()
-
-	admin, err := sql.Open("mysql", adminDSN)
-	if err != nil {
-		return err
-	}
-	defer admin.Close()
-
-	createStmt := fmt.Sprintf(
-		"CREATE DATABASE IF NOT EXISTS `%s` DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci",
-		dbName,
-	)
-	if _, err := admin.Exec(createStmt); err != nil {
-		return err
-	}
+// slogWriter routes GORM's slow-query and error lines to the process
+// logger. Lookups that find nothing are expected and not logged.
+type slogWriter struct{}
 
-	return nil
+func (slogWriter) Printf(format string, args ...interface{}) {
+	slog.Warn("gorm", "detail", fmt.Sprintf(format, args...))
 }
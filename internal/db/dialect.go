@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// dialect is what differs between the supported databases. Each has its own
+// directory under migrations.
+type dialect struct {
+	open func(dsn string) gorm.Dialector
+	// ensureDatabase creates the database named by dsn if it is missing.
+	ensureDatabase func(dsn string) error
+	// configure, if set, adjusts the connection pool after opening.
+	configure func(conn *gorm.DB, dsn string) error
+
+	// lock serializes migrators on conn. release is called with whether
+	// the work done under the lock failed.
+	lock func(ctx context.Context, conn *sql.Conn) (release func(failed bool) error, err error)
+	// transactionalDDL means a migration can run in a transaction together
+	// with its schema_migrations row, so it is never left dirty.
+	transactionalDDL bool
+	// lockIsTransaction means everything done under the lock commits or
+	// rolls back together, so a failed run applies nothing at all.
+	lockIsTransaction bool
+	// createMigrationsTable creates schema_migrations if it is missing.
+	createMigrationsTable string
+	// numberedParams means the driver wants $1, $2, ... instead of ?.
+	numberedParams bool
+}
+
+var dialects = map[string]dialect{
+	"mysql":    mysqlDialect,
+	"postgres": postgresDialect,
+	"sqlite":   sqliteDialect,
+}
+
+// rebind rewrites the ? placeholders in query for the dialect. The queries
+// it is used on contain no other question marks.
+func (d dialect) rebind(query string) string {
+	if !d.numberedParams {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
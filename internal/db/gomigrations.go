@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"webFianlBackend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// goMigrations are the migrations that need more than a script, shared by
+// every driver. They mostly bring databases created from the old schema.sql
+// up to date: schema.sql only ever grew its CREATE TABLE statements, so such
+// a database has whichever users columns existed when it was created.
+var goMigrations = []Migration{
+	{Version: 2, Name: "add_user_columns", upFunc: addUserColumns, downFunc: keepUserColumns},
+	{Version: 3, Name: "normalize_identity", upFunc: normalizeIdentity, downFunc: dropNormalizedIdentity, check: checkIdentityCollisions},
+}
+
+// userColumn is a users column added after the original schema, with its
+// definition per driver.
+type userColumn struct {
+	name                    string
+	mysql, postgres, sqlite string
+}
+
+var addedUserColumns = []userColumn{
+	{"token_version", "INT UNSIGNED NOT NULL DEFAULT 0", "INTEGER NOT NULL DEFAULT 0", "INTEGER NOT NULL DEFAULT 0"},
+	{"email_verified_at", "DATETIME NULL", "TIMESTAMPTZ NULL", "DATETIME NULL"},
+	{"totp_secret", "VARCHAR(64) NULL", "VARCHAR(64) NULL", "VARCHAR(64) NULL"},
+	{"totp_enabled", "TINYINT(1) NOT NULL DEFAULT 0", "BOOLEAN NOT NULL DEFAULT FALSE", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"totp_last_step", "BIGINT NOT NULL DEFAULT 0", "BIGINT NOT NULL DEFAULT 0", "INTEGER NOT NULL DEFAULT 0"},
+	{"failed_logins", "INT NOT NULL DEFAULT 0", "INTEGER NOT NULL DEFAULT 0", "INTEGER NOT NULL DEFAULT 0"},
+	{"last_failed_login_at", "DATETIME NULL", "TIMESTAMPTZ NULL", "DATETIME NULL"},
+	{"locked_until", "DATETIME NULL", "TIMESTAMPTZ NULL", "DATETIME NULL"},
+	{"is_admin", "TINYINT(1) NOT NULL DEFAULT 0", "BOOLEAN NOT NULL DEFAULT FALSE", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"suspended_at", "DATETIME NULL", "TIMESTAMPTZ NULL", "DATETIME NULL"},
+}
+
+// addUserColumns adds the users columns that the database is missing. On a
+// database created by migration 1 it does nothing.
+func addUserColumns(ctx context.Context, tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range addedUserColumns {
+		if migrator.HasColumn(&models.User{}, column.name) {
+			continue
+		}
+		definition := map[string]string{
+			"mysql":    column.mysql,
+			"postgres": column.postgres,
+			"sqlite":   column.sqlite,
+		}[tx.Dialector.Name()]
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE users ADD COLUMN %s %s", column.name, definition)).Error; err != nil {
+			return fmt.Errorf("add users.%s: %w", column.name, err)
+		}
+	}
+	return nil
+}
+
+// keepUserColumns reverts add_user_columns by leaving the columns alone:
+// migration 1 creates them too, and its down drops the table.
+func keepUserColumns(context.Context, *gorm.DB) error {
+	return nil
+}
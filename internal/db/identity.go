@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// IdentityCollision is a group of users whose usernames or emails become
+// equal once normalized.
+type IdentityCollision struct {
+	Field   string
+	Key     string
+	UserIDs []uint
+	Values  []string
+}
+
+func (ic IdentityCollision) String() string {
+	ids := make([]string, len(ic.UserIDs))
+	for i, id := range ic.UserIDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	return fmt.Sprintf("%s %q: users %s (%s)", ic.Field, ic.Key, strings.Join(ids, ", "), strings.Join(ic.Values, ", "))
+}
+
+type identityRow struct {
+	ID       uint
+	Username string
+	Email    string
+}
+
+// FindIdentityCollisions reports users that would share a normalized
+// username or email. Normalization happens in Go, so it works before the
+// normalized columns exist.
+func FindIdentityCollisions(conn *gorm.DB) ([]IdentityCollision, error) {
+	type group struct {
+		ids    []uint
+		values []string
+	}
+	byField := map[string]map[string]*group{"username": {}, "email": {}}
+	add := func(field, value string, id uint) {
+		key := utils.IdentityKey(value)
+		g, ok := byField[field][key]
+		if !ok {
+			g = &group{}
+			byField[field][key] = g
+		}
+		g.ids = append(g.ids, id)
+		g.values = append(g.values, value)
+	}
+
+	var batch []identityRow
+	err := conn.Table("users").Select("id, username, email").Order("id").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, row := range batch {
+				add("username", row.Username, row.ID)
+				add("email", row.Email, row.ID)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var collisions []IdentityCollision
+	for _, field := range []string{"username", "email"} {
+		for key, g := range byField[field] {
+			if len(g.ids) > 1 {
+				collisions = append(collisions, IdentityCollision{Field: field, Key: key, UserIDs: g.ids, Values: g.values})
+			}
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Field != collisions[j].Field {
+			return collisions[i].Field > collisions[j].Field
+		}
+		return collisions[i].Key < collisions[j].Key
+	})
+	return collisions, nil
+}
+
+// IdentityCollisionsError stops the normalize_identity migration while
+// existing accounts would collide once normalized.
+type IdentityCollisionsError struct {
+	Collisions []IdentityCollision
+}
+
+func (e *IdentityCollisionsError) Error() string {
+	lines := make([]string, len(e.Collisions))
+	for i, collision := range e.Collisions {
+		lines[i] = "\n  " + collision.String()
+	}
+	return fmt.Sprintf("%d normalized usernames or emails are shared by several accounts; rename or merge them (see cmd/identity-check), then migrate again:%s",
+		len(e.Collisions), strings.Join(lines, ""))
+}
+
+// checkIdentityCollisions refuses the normalize_identity migration while
+// accounts collide, before anything is changed, so that an operator rather
+// than the unique indexes decides which account keeps the name.
+func checkIdentityCollisions(_ context.Context, tx *gorm.DB) error {
+	collisions, err := FindIdentityCollisions(tx)
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		return &IdentityCollisionsError{Collisions: collisions}
+	}
+	return nil
+}
+
+// normalizeIdentity adds username_normalized and email_normalized, fills
+// them in for existing accounts and makes them unique. Databases that ran
+// this before it was a tracked migration already have some of it.
+func normalizeIdentity(_ context.Context, tx *gorm.DB) error {
+	driver := tx.Dialector.Name()
+	migrator := tx.Migrator()
+	for _, column := range normalizedColumns {
+		if migrator.HasColumn(&models.User{}, column.name) {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE users ADD COLUMN %s VARCHAR(%d) NULL", column.name, column.size)
+		if driver == "mysql" {
+			stmt = fmt.Sprintf("ALTER TABLE users ADD COLUMN %s VARCHAR(%d) COLLATE utf8mb4_bin NULL", column.name, column.size)
+		}
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	var batch []identityRow
+	err := tx.Table("users").Select("id, username, email").
+		Where("username_normalized IS NULL OR email_normalized IS NULL").
+		FindInBatches(&batch, 500, func(batchTx *gorm.DB, _ int) error {
+			for _, row := range batch {
+				if err := tx.Table("users").Where("id = ?", row.ID).Updates(map[string]interface{}{
+					"username_normalized": utils.IdentityKey(row.Username),
+					"email_normalized":    utils.IdentityKey(row.Email),
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	// SQLite cannot add NOT NULL to an existing column; the application
+	// always sets both.
+	for _, column := range normalizedColumns {
+		var stmt string
+		switch driver {
+		case "mysql":
+			stmt = fmt.Sprintf("ALTER TABLE users MODIFY %s VARCHAR(%d) COLLATE utf8mb4_bin NOT NULL", column.name, column.size)
+		case "postgres":
+			stmt = fmt.Sprintf("ALTER TABLE users ALTER COLUMN %s SET NOT NULL", column.name)
+		default:
+			continue
+		}
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	for _, column := range normalizedColumns {
+		if migrator.HasIndex(&models.User{}, column.index) {
+			continue
+		}
+		if err := tx.Exec(fmt.Sprintf("CREATE UNIQUE INDEX %s ON users (%s)", column.index, column.name)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropNormalizedIdentity reverts normalize_identity.
+func dropNormalizedIdentity(_ context.Context, tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	for _, column := range normalizedColumns {
+		if migrator.HasIndex(&models.User{}, column.index) {
+			if err := migrator.DropIndex(&models.User{}, column.index); err != nil {
+				return err
+			}
+		}
+		if migrator.HasColumn(&models.User{}, column.name) {
+			if err := tx.Exec("ALTER TABLE users DROP COLUMN " + column.name).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var normalizedColumns = []struct {
+	name  string
+	size  int
+	index string
+}{
+	{"username_normalized", 64, "idx_users_username_normalized"},
+	{"email_normalized", 255, "idx_users_email_normalized"},
+}
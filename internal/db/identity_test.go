@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeIdentityRefusesCollisions(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	for _, stmt := range splitStatements(legacySchema) {
+		if err := conn.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Distinct to the old unique keys, equal once normalized.
+	for _, stmt := range []string{
+		"INSERT INTO users (id, username, email, password) VALUES (10, 'Straße', 'a@example.com', 'x')",
+		"INSERT INTO users (id, username, email, password) VALUES (11, 'STRASSE', 'b@example.com', 'x')",
+		"INSERT INTO users (id, username, email, password) VALUES (12, 'carol', 'C@Example.com', 'x')",
+		"INSERT INTO users (id, username, email, password) VALUES (13, 'dave', 'c@example.com', 'x')",
+	} {
+		if err := conn.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newTestMigrator(t, conn)
+	_, err := m.Up(ctx, 0)
+	var collisionErr *IdentityCollisionsError
+	if !errors.As(err, &collisionErr) {
+		t.Fatalf("Up = %v, want IdentityCollisionsError", err)
+	}
+	want := []IdentityCollision{
+		{Field: "username", Key: "strasse", UserIDs: []uint{10, 11}, Values: []string{"Straße", "STRASSE"}},
+		{Field: "email", Key: "c@example.com", UserIDs: []uint{12, 13}, Values: []string{"C@Example.com", "c@example.com"}},
+	}
+	if !reflect.DeepEqual(collisionErr.Collisions, want) {
+		t.Fatalf("collisions = %+v, want %+v", collisionErr.Collisions, want)
+	}
+
+	// Nothing was merged or half-applied.
+	var count int64
+	if err := conn.Table("users").Count(&count).Error; err != nil || count != 5 {
+		t.Fatalf("users = %d, %v; want 5", count, err)
+	}
+	if conn.Migrator().HasColumn("users", "username_normalized") {
+		t.Fatal("normalized columns added despite collisions")
+	}
+
+	if err := conn.Exec("UPDATE users SET username = 'strasse2' WHERE id = 11").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Exec("UPDATE users SET email = 'd@example.com' WHERE id = 13").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up after resolving: %v", err)
+	}
+	var keys []string
+	if err := conn.Table("users").Order("id").Pluck("username_normalized", &keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bob", "strasse", "strasse2", "carol", "dave"}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("username_normalized = %q, want %q", keys, want)
+	}
+	if err := conn.Exec("INSERT INTO users (username, email, password, username_normalized, email_normalized) VALUES ('STRASSE', 'e@example.com', 'x', 'strasse', 'e@example.com')").Error; err == nil {
+		t.Fatal("inserted a duplicate normalized username")
+	}
+}
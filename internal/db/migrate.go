@@ -0,0 +1,540 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds a directory of migrations per dialect.
+//
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationFileName matches NNNN_name.up.sql and NNNN_name.down.sql.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+const (
+	migrationsTable = "schema_migrations"
+	// migrationLockTimeout is how long to wait for another instance that is
+	// migrating the same database.
+	migrationLockTimeout = 60 * time.Second
+)
+
+// Migration is one schema change, either an embedded SQL script or Go code
+// from goMigrations. A migration without Down cannot be reverted.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+
+	// upFunc and downFunc replace the scripts of Go migrations. They run on
+	// the migration's connection, or its transaction where DDL is
+	// transactional, and must not use other connections.
+	upFunc, downFunc func(ctx context.Context, tx *gorm.DB) error
+	// check, if set, runs before the migration is recorded. A failed check
+	// leaves nothing to repair, even where DDL is not transactional.
+	check func(ctx context.Context, tx *gorm.DB) error
+}
+
+func (m Migration) reversible() bool {
+	return m.Down != "" || m.downFunc != nil
+}
+
+// MigrationStatus is a migration and its state in the database. AppliedAt
+// is empty while the migration is pending. A dirty migration failed part way
+// and has to be repaired by hand; see Migrator.Force.
+type MigrationStatus struct {
+	Migration
+	AppliedAt string
+	Dirty     bool
+}
+
+// Migrations returns the embedded migrations for driver, together with the
+// Go migrations, in version order.
+func Migrations(driver string) ([]Migration, error) {
+	if _, ok := dialects[driver]; !ok {
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must look like 0001_name.up.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d: files disagree on the name (%s, %s)", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion)+len(goMigrations))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d: missing up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	for _, m := range goMigrations {
+		if _, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("migration %d: defined both in Go and as a file", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts the embedded migrations. Each operation holds
+// a database-wide lock, so replicas starting together apply them once.
+type Migrator struct {
+	db         *gorm.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator for the migrations of conn's dialect.
+func NewMigrator(conn *gorm.DB) (*Migrator, error) {
+	driver := conn.Dialector.Name()
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: conn, dialect: dialects[driver], migrations: migrations}, nil
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	name      string
+	dirty     bool
+	appliedAt string
+}
+
+// Up applies up to n pending migrations in version order, or all of them if
+// n <= 0, and returns the ones applied. It refuses to run while a migration
+// is dirty.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := readApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if n > 0 && len(done) == n {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if migration.check != nil {
+				if err := migration.check(ctx, m.session(ctx, conn)); err != nil {
+					return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+				}
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return m.completed(done, err), err
+}
+
+// Down reverts the n most recently applied migrations, newest first, and
+// returns the ones reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := readApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkDirty(applied); err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if !migration.reversible() {
+				return fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return m.completed(done, err), err
+}
+
+// completed returns the migrations a run got through: none if it failed
+// and its dialect rolled the whole run back.
+func (m *Migrator) completed(done []Migration, err error) []Migration {
+	if err != nil && m.dialect.lockIsTransaction {
+		return nil
+	}
+	return done
+}
+
+// Status lists every embedded migration with its state, followed by any
+// applied versions this build does not know about.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := readApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Migration: migration}
+			if row, ok := applied[migration.Version]; ok {
+				status.AppliedAt = row.appliedAt
+				status.Dirty = row.dirty
+				delete(applied, migration.Version)
+			}
+			statuses = append(statuses, status)
+		}
+		unknown := make([]int, 0, len(applied))
+		for version := range applied {
+			unknown = append(unknown, version)
+		}
+		sort.Ints(unknown)
+		for _, version := range unknown {
+			row := applied[version]
+			statuses = append(statuses, MigrationStatus{
+				Migration: Migration{Version: version, Name: row.name},
+				AppliedAt: row.appliedAt,
+				Dirty:     row.dirty,
+			})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Force clears the dirty flag of version once an operator has finished or
+// undone its changes by hand. To mark it as not applied instead, delete its
+// row from schema_migrations.
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		result, err := conn.ExecContext(ctx, m.dialect.rebind("UPDATE schema_migrations SET dirty = ? WHERE version = ? AND dirty = ?"), false, version, true)
+		if err != nil {
+			return err
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return fmt.Errorf("migration %d is not recorded or not dirty", version)
+		}
+		return nil
+	})
+}
+
+// apply runs a migration's up script. Where DDL is transactional the script
+// and its schema_migrations row commit together. Otherwise (MySQL) the row
+// is written as dirty first and only cleared once every statement has
+// succeeded.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	return m.run(ctx, conn, func(db gorm.ConnPool, final bool) error {
+		if _, err := db.ExecContext(ctx, m.dialect.rebind("INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, ?)"),
+			migration.Version, migration.Name, !final); err != nil {
+			return err
+		}
+		if err := m.exec(ctx, db, migration.Up, migration.upFunc); err != nil {
+			return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if final {
+			return nil
+		}
+		_, err := db.ExecContext(ctx, m.dialect.rebind("UPDATE schema_migrations SET dirty = ? WHERE version = ?"), false, migration.Version)
+		return err
+	})
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	return m.run(ctx, conn, func(db gorm.ConnPool, final bool) error {
+		if !final {
+			if _, err := db.ExecContext(ctx, m.dialect.rebind("UPDATE schema_migrations SET dirty = ? WHERE version = ?"), true, migration.Version); err != nil {
+				return err
+			}
+		}
+		if err := m.exec(ctx, db, migration.Down, migration.downFunc); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+		_, err := db.ExecContext(ctx, m.dialect.rebind("DELETE FROM schema_migrations WHERE version = ?"), migration.Version)
+		return err
+	})
+}
+
+// run calls fn in a transaction if the dialect's DDL is transactional, in
+// which case final is true: fn's writes cannot be left half done.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, fn func(db gorm.ConnPool, final bool) error) error {
+	if !m.dialect.transactionalDDL {
+		return fn(conn, false)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx, true); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// locked runs fn on a single connection holding the dialect's migration
+// lock, creating schema_migrations if needed.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) (err error) {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	release, err := m.dialect.lock(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("migration lock: %w", err)
+	}
+	defer func() {
+		if releaseErr := release(err != nil); err == nil && releaseErr != nil {
+			err = fmt.Errorf("migration lock release: %w", releaseErr)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createMigrationsTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func readApplied(ctx context.Context, conn *sql.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.dirty, &row.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+func checkDirty(applied map[int]appliedMigration) error {
+	for version, row := range applied {
+		if row.dirty {
+			return fmt.Errorf("migration %d_%s is dirty: it failed part way and must be repaired by hand, then marked with \"migrate force %d\"", version, row.name, version)
+		}
+	}
+	return nil
+}
+
+// exec runs a migration's script, or fn for a Go migration, on db.
+func (m *Migrator) exec(ctx context.Context, db gorm.ConnPool, script string, fn func(context.Context, *gorm.DB) error) error {
+	if fn == nil {
+		return execScript(ctx, db, script)
+	}
+	return fn(ctx, m.session(ctx, db))
+}
+
+// session returns a GORM handle that runs its queries on db. GORM must not
+// wrap writes in transactions of its own: db may already be one.
+func (m *Migrator) session(ctx context.Context, db gorm.ConnPool) *gorm.DB {
+	tx := m.db.Session(&gorm.Session{NewDB: true, Context: ctx, SkipDefaultTransaction: true})
+	tx.Statement.ConnPool = db
+	return tx
+}
+
+func execScript(ctx context.Context, db gorm.ConnPool, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script on semicolons outside quotes and
+// comments, dropping the comments. It does not understand DELIMITER, so
+// migrations cannot define stored routines.
+func splitStatements(script string) []string {
+	var stmts []string
+	var b strings.Builder
+	hasCode := false
+	flush := func() {
+		if hasCode {
+			stmts = append(stmts, strings.TrimSpace(b.String()))
+		}
+		b.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		ch := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end
+			b.WriteByte('\n')
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end + 3
+			b.WriteByte(' ')
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(script) {
+				if script[j] == '\\' && ch != '`' {
+					j += 2
+					continue
+				}
+				if script[j] == ch {
+					if j+1 < len(script) && script[j+1] == ch {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			b.WriteString(script[i : j+1])
+			hasCode = true
+			i = j
+		case ch == ';':
+			flush()
+		default:
+			b.WriteByte(ch)
+			if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+	return stmts
+}
+
+// CheckSchema reports whether any embedded migration is pending or dirty.
+// Applied versions this build does not know about are fine: they come from
+// a newer build during a rolling deploy.
+func CheckSchema(ctx context.Context, conn *gorm.DB) error {
+	migrations, err := Migrations(conn.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	conn = conn.WithContext(ctx)
+
+	type row struct {
+		Version int
+		Dirty   bool
+	}
+	var rows []row
+	if conn.Migrator().HasTable(migrationsTable) {
+		if err := conn.Raw("SELECT version, dirty FROM schema_migrations").Scan(&rows).Error; err != nil {
+			return err
+		}
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool, len(rows))
+	schemaErr := &SchemaVersionError{}
+	for _, r := range rows {
+		applied[r.Version] = true
+		if r.Dirty {
+			schemaErr.Dirty = append(schemaErr.Dirty, r.Version)
+		}
+	}
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			schemaErr.Pending = append(schemaErr.Pending, migration.Version)
+		}
+	}
+	if len(schemaErr.Pending) > 0 || len(schemaErr.Dirty) > 0 {
+		sort.Ints(schemaErr.Dirty)
+		return schemaErr
+	}
+	return nil
+}
+
+// SchemaVersionError is returned by CheckSchema.
+type SchemaVersionError struct {
+	Pending []int
+	Dirty   []int
+}
+
+func (e *SchemaVersionError) Error() string {
+	var parts []string
+	if len(e.Pending) > 0 {
+		parts = append(parts, "pending migrations: "+joinInts(e.Pending))
+	}
+	if len(e.Dirty) > 0 {
+		parts = append(parts, "dirty migrations: "+joinInts(e.Dirty))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB returns an empty in-memory SQLite database.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return conn
+}
+
+func newTestMigrator(t *testing.T, conn *gorm.DB) *Migrator {
+	t.Helper()
+	m, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func versions(migrations []Migration) []int {
+	out := []int{}
+	for _, m := range migrations {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+func appliedVersions(t *testing.T, m *Migrator) []int {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []int{}
+	for _, status := range statuses {
+		if status.AppliedAt != "" {
+			out = append(out, status.Version)
+		}
+	}
+	return out
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	m := newTestMigrator(t, conn)
+	all := versions(m.migrations)
+	if len(all) < 3 {
+		t.Fatalf("migrations = %v, want at least 3", all)
+	}
+
+	if got := appliedVersions(t, m); len(got) != 0 {
+		t.Fatalf("applied before Up = %v", got)
+	}
+	if err := CheckSchema(ctx, conn); err == nil {
+		t.Fatal("CheckSchema on an empty database succeeded")
+	}
+
+	done, err := m.Up(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, all[:1]) {
+		t.Fatalf("Up(1) applied %v, want %v", got, all[:1])
+	}
+
+	done, err = m.Up(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, all[1:]) {
+		t.Fatalf("Up applied %v, want %v", got, all[1:])
+	}
+	if got := appliedVersions(t, m); !reflect.DeepEqual(got, all) {
+		t.Fatalf("applied = %v, want %v", got, all)
+	}
+	if err := CheckSchema(ctx, conn); err != nil {
+		t.Fatalf("CheckSchema after Up: %v", err)
+	}
+	for _, table := range []string{"users", "channels", "channel_members", "sessions", "audit_events"} {
+		if !conn.Migrator().HasTable(table) {
+			t.Errorf("table %s missing after Up", table)
+		}
+	}
+	if !conn.Migrator().HasIndex("users", "idx_users_username_normalized") {
+		t.Error("normalized username index missing after Up")
+	}
+
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Fatalf("second Up = %v, %v; want nothing", versions(done), err)
+	}
+
+	done, err = m.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !reflect.DeepEqual(got, all[len(all)-1:]) {
+		t.Fatalf("Down(1) reverted %v, want %v", got, all[len(all)-1:])
+	}
+	var schemaErr *SchemaVersionError
+	if err := CheckSchema(ctx, conn); !errors.As(err, &schemaErr) || !reflect.DeepEqual(schemaErr.Pending, all[len(all)-1:]) {
+		t.Fatalf("CheckSchema after Down(1) = %v", err)
+	}
+
+	done, err = m.Down(ctx, len(all))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(all)-1 {
+		t.Fatalf("Down reverted %v", versions(done))
+	}
+	if conn.Migrator().HasTable("users") {
+		t.Error("users still exists after reverting everything")
+	}
+	if got := appliedVersions(t, m); len(got) != 0 {
+		t.Fatalf("applied after Down = %v", got)
+	}
+}
+
+func TestMigratorForce(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	m := newTestMigrator(t, conn)
+	if _, err := m.Up(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dirty rows only arise on MySQL; mark one by hand.
+	if err := conn.Exec("UPDATE schema_migrations SET dirty = ? WHERE version = 1", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err == nil || !strings.Contains(err.Error(), "dirty") {
+		t.Fatalf("Up with a dirty migration = %v, want a dirty error", err)
+	}
+	if _, err := m.Down(ctx, 1); err == nil {
+		t.Fatal("Down with a dirty migration succeeded")
+	}
+	var schemaErr *SchemaVersionError
+	if err := CheckSchema(ctx, conn); !errors.As(err, &schemaErr) || !reflect.DeepEqual(schemaErr.Dirty, []int{1}) {
+		t.Fatalf("CheckSchema = %v, want dirty [1]", err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Dirty {
+		t.Fatalf("Status()[0] = %+v, want dirty", statuses[0])
+	}
+
+	if err := m.Force(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Force(ctx, 1); err == nil {
+		t.Fatal("forcing a clean migration succeeded")
+	}
+	if err := m.Force(ctx, 999); err == nil {
+		t.Fatal("forcing an unknown migration succeeded")
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatalf("Up after Force: %v", err)
+	}
+}
+
+func TestMigratorRollsBackFailedRun(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	m := newTestMigrator(t, conn)
+	m.migrations = append(m.migrations, Migration{Version: 9999, Name: "broken", Up: "CREATE TABLE broken (;"})
+
+	done, err := m.Up(ctx, 0)
+	if err == nil || !strings.Contains(err.Error(), "9999_broken") {
+		t.Fatalf("Up = %v, want the broken migration's error", err)
+	}
+	if len(done) != 0 {
+		t.Fatalf("Up reported %v as applied after rolling back", versions(done))
+	}
+	if got := appliedVersions(t, m); len(got) != 0 {
+		t.Fatalf("applied = %v, want nothing", got)
+	}
+	if conn.Migrator().HasTable("users") {
+		t.Error("users exists after the run rolled back")
+	}
+}
+
+func TestMigratorDownIrreversible(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	m := newTestMigrator(t, conn)
+	m.migrations = append(m.migrations, Migration{Version: 9999, Name: "one_way", Up: "CREATE TABLE one_way (id INTEGER)"})
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Down(ctx, 1); err == nil || !strings.Contains(err.Error(), "cannot be reverted") {
+		t.Fatalf("Down = %v, want cannot be reverted", err)
+	}
+}
+
+// legacySchema is the original schema.sql, as SQLite.
+const legacySchema = `
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  username VARCHAR(64) NOT NULL UNIQUE,
+  email VARCHAR(255) NOT NULL UNIQUE,
+  password VARCHAR(255) NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE channels (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(64) NOT NULL,
+  owner_id INTEGER NOT NULL REFERENCES users (id),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE channel_members (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  channel_id INTEGER NOT NULL REFERENCES channels (id),
+  user_id INTEGER NOT NULL REFERENCES users (id),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO users (username, email, password) VALUES ('Ｂob', 'Bob@Example.com', 'x');
+`
+
+func TestMigratorUpgradesLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	conn := openTestDB(t)
+	for _, stmt := range splitStatements(legacySchema) {
+		if err := conn.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newTestMigrator(t, conn)
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range addedUserColumns {
+		if !conn.Migrator().HasColumn("users", column.name) {
+			t.Errorf("users.%s missing after Up", column.name)
+		}
+	}
+
+	var row struct {
+		UsernameNormalized string
+		EmailNormalized    string
+		TokenVersion       int
+		IsAdmin            bool
+	}
+	if err := conn.Table("users").Select("username_normalized, email_normalized, token_version, is_admin").Take(&row).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.UsernameNormalized != "bob" || row.EmailNormalized != "bob@example.com" || row.TokenVersion != 0 || row.IsAdmin {
+		t.Fatalf("upgraded row = %+v", row)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"only comments", "-- one\n/* two; */\n", nil},
+		{"empty statements", ";; ;\n;", nil},
+		{"trailing statement without semicolon", "SELECT 1;\nSELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"line comment with semicolon", "SELECT 1 -- not; a split\n;", []string{"SELECT 1"}},
+		{"comment at end without newline", "SELECT 1; -- done", []string{"SELECT 1"}},
+		{"block comment with semicolon", "SELECT /* a; b */ 1;", []string{"SELECT   1"}},
+		{"single quoted semicolon", "INSERT INTO t VALUES ('a;b');", []string{"INSERT INTO t VALUES ('a;b')"}},
+		{"doubled quote", "SELECT 'it''s; fine';", []string{"SELECT 'it''s; fine'"}},
+		{"backslash escape", `SELECT 'a\';b';SELECT 2`, []string{`SELECT 'a\';b'`, "SELECT 2"}},
+		{"double quoted identifier", `SELECT "a;b" FROM t;`, []string{`SELECT "a;b" FROM t`}},
+		{"backtick identifier", "SELECT `a;b` FROM t;", []string{"SELECT `a;b` FROM t"}},
+		{"comment marker in quotes", "SELECT '-- x; /* y'; SELECT 2;", []string{"SELECT '-- x; /* y'", "SELECT 2"}},
+		{"unterminated quote", "SELECT 'abc", []string{"SELECT 'abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS audit_events;
+DROP TABLE IF EXISTS account_unlocks;
+DROP TABLE IF EXISTS personal_access_tokens;
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS channel_members;
+DROP TABLE IF EXISTS channels;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,157 @@
+-- Initial schema, matching mysql/0001_initial.up.sql. The normalized
+-- identity columns are added by migration 3.
+
+CREATE TABLE IF NOT EXISTS users (
+  id BIGSERIAL NOT NULL,
+  username VARCHAR(64) NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  password VARCHAR(255) NOT NULL,
+  token_version INTEGER NOT NULL DEFAULT 0,
+  email_verified_at TIMESTAMPTZ NULL,
+  totp_secret VARCHAR(64) NULL,
+  totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  totp_last_step BIGINT NOT NULL DEFAULT 0,
+  failed_logins INTEGER NOT NULL DEFAULT 0,
+  last_failed_login_at TIMESTAMPTZ NULL,
+  locked_until TIMESTAMPTZ NULL,
+  is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+  suspended_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS channels (
+  id BIGSERIAL NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  owner_id BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_channels_owner FOREIGN KEY (owner_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_owner_name ON channels (owner_id, name);
+CREATE INDEX IF NOT EXISTS idx_channels_owner_id ON channels (owner_id);
+
+CREATE TABLE IF NOT EXISTS channel_members (
+  id BIGSERIAL NOT NULL,
+  channel_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_channel_members_channel FOREIGN KEY (channel_id) REFERENCES channels (id),
+  CONSTRAINT fk_channel_members_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channel_user ON channel_members (channel_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_channel_members_channel ON channel_members (channel_id);
+CREATE INDEX IF NOT EXISTS idx_channel_members_user ON channel_members (user_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+  id VARCHAR(64) NOT NULL,
+  user_id BIGINT NOT NULL,
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  email VARCHAR(255) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_email_verifications_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_email_verifications_token_hash ON email_verifications (token_hash);
+CREATE INDEX IF NOT EXISTS idx_email_verifications_user_id ON email_verifications (user_id);
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_password_resets_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_password_resets_token_hash ON password_resets (token_hash);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  code_hash CHAR(64) NOT NULL,
+  used_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  issuer VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_issuer_subject ON user_identities (issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  prefix VARCHAR(16) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  scopes VARCHAR(255) NOT NULL,
+  expires_at TIMESTAMPTZ NULL,
+  last_used_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS account_unlocks (
+  id BIGSERIAL NOT NULL,
+  user_id BIGINT NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  CONSTRAINT fk_account_unlocks_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_unlocks_token_hash ON account_unlocks (token_hash);
+CREATE INDEX IF NOT EXISTS idx_account_unlocks_user_id ON account_unlocks (user_id);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+  id BIGSERIAL NOT NULL,
+  action VARCHAR(64) NOT NULL,
+  actor_id BIGINT NULL,
+  actor_name VARCHAR(64) NOT NULL DEFAULT '',
+  target_user_id BIGINT NULL,
+  channel_id BIGINT NULL,
+  ip VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent VARCHAR(255) NOT NULL DEFAULT '',
+  metadata TEXT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events (action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_user_id ON audit_events (target_user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_channel_id ON audit_events (channel_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
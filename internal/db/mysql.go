@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	gormmysql "gorm.io/driver/mysql"
+)
+
+var mysqlDialect = dialect{
+	open:           gormmysql.Open,
+	ensureDatabase: ensureMySQLDatabase,
+	lock:           lockMySQL,
+	createMigrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  dirty TINYINT(1) NOT NULL DEFAULT 0,
+  applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+}
+
+func ensureMySQLDatabase(dsn string) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return err
+	}
+
+	dbName := cfg.DBName
+	if dbName == "" {
+		return nil
+	}
+
+	cfg.DBName = ""
+	adminDSN := cfg.FormatDSN()
+
+	admin, err := sql.Open("mysql", adminDSN)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	createStmt := fmt.Sprintf(
+		"CREATE DATABASE IF NOT EXISTS `%s` DEFAULT CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci",
+		dbName,
+	)
+	if _, err := admin.Exec(createStmt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// lockMySQL takes a named lock scoped to the current database. The lock
+// belongs to the session, so it must be released before the connection goes
+// back to the pool.
+func lockMySQL(ctx context.Context, conn *sql.Conn) (func(bool) error, error) {
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT(DATABASE(), '.schema_migrations'), ?)",
+		int(migrationLockTimeout.Seconds())).Scan(&acquired); err != nil {
+		return nil, err
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		return nil, fmt.Errorf("still held by another instance after %s", migrationLockTimeout)
+	}
+	return func(bool) error {
+		var released sql.NullInt64
+		return conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(CONCAT(DATABASE(), '.schema_migrations'))").Scan(&released)
+	}, nil
+}
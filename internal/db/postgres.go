@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+)
+
+// postgresLockKey is the advisory lock key for migrations. Advisory locks
+// are scoped to the current database.
+const postgresLockKey = 0x6d696772 // "migr"
+
+var postgresDialect = dialect{
+	open:             postgres.Open,
+	ensureDatabase:   ensurePostgresDatabase,
+	lock:             lockPostgres,
+	transactionalDDL: true,
+	numberedParams:   true,
+	createMigrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  dirty BOOLEAN NOT NULL DEFAULT FALSE,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`,
+}
+
+// ensurePostgresDatabase creates the target database if connecting to it
+// fails because it does not exist, going through the maintenance database
+// "postgres" with the same credentials. Roles that cannot do that need the
+// database created for them, as managed services usually do.
+func ensurePostgresDatabase(dsn string) error {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err == nil {
+		return conn.Close(ctx)
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "3D000" { // invalid_catalog_name
+		return err
+	}
+
+	dbName := cfg.Database
+	cfg.Database = "postgres"
+	admin, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.Close(context.Background())
+	_, err = admin.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{dbName}.Sanitize())
+	if errors.As(err, &pgErr) && pgErr.Code == "42P04" { // duplicate_database: another instance won
+		return nil
+	}
+	return err
+}
+
+// lockPostgres polls for a session-level advisory lock, so that waiting is
+// bounded by migrationLockTimeout like on MySQL.
+func lockPostgres(ctx context.Context, conn *sql.Conn) (func(bool) error, error) {
+	deadline := time.Now().Add(migrationLockTimeout)
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", postgresLockKey).Scan(&acquired); err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("still held by another instance after %s", migrationLockTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return func(bool) error {
+		var released bool
+		return conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1)", postgresLockKey).Scan(&released)
+	}, nil
+}
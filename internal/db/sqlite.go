@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteDefaultParams are added to the DSN unless it sets them. Writers
+// wait for each other instead of failing with SQLITE_BUSY, and transactions
+// take the write lock up front so they cannot deadlock upgrading it.
+var sqliteDefaultParams = []string{
+	"_pragma=foreign_keys(1)",
+	"_pragma=journal_mode(WAL)",
+	"_pragma=busy_timeout(10000)",
+	"_txlock=immediate",
+}
+
+var sqliteDialect = dialect{
+	open:           openSQLite,
+	ensureDatabase: ensureSQLiteDirectory,
+	configure:      configureSQLite,
+	lock:           lockSQLite,
+	// BEGIN IMMEDIATE is the lock, so migrations cannot have transactions
+	// of their own.
+	lockIsTransaction: true,
+	createMigrationsTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER NOT NULL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  dirty BOOLEAN NOT NULL DEFAULT 0,
+  applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`,
+}
+
+func openSQLite(dsn string) gorm.Dialector {
+	path, query, _ := strings.Cut(dsn, "?")
+	for _, param := range sqliteDefaultParams {
+		name, _, _ := strings.Cut(param, "=")
+		if name == "_pragma" {
+			pragma, _, _ := strings.Cut(strings.TrimPrefix(param, "_pragma="), "(")
+			if strings.Contains(query, "_pragma="+pragma) {
+				continue
+			}
+		} else if strings.Contains(query, name+"=") {
+			continue
+		}
+		if query != "" {
+			query += "&"
+		}
+		query += param
+	}
+	return sqlite.Open(path + "?" + query)
+}
+
+// sqlitePath returns the file named by dsn, or "" for an in-memory database.
+func sqlitePath(dsn string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" || path == ":memory:" {
+		return ""
+	}
+	if params, err := url.ParseQuery(query); err == nil && params.Get("mode") == "memory" {
+		return ""
+	}
+	return path
+}
+
+// ensureSQLiteDirectory creates the directory of the database file; SQLite
+// creates the file itself.
+func ensureSQLiteDirectory(dsn string) error {
+	path := sqlitePath(dsn)
+	if path == "" {
+		return nil
+	}
+	return os.MkdirAll(filepath.Dir(path), 0o755)
+}
+
+// configureSQLite keeps an in-memory database on a single connection, since
+// each connection would otherwise get its own empty database.
+func configureSQLite(conn *gorm.DB, dsn string) error {
+	if sqlitePath(dsn) != "" {
+		return nil
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+	return nil
+}
+
+// lockSQLite starts a write transaction, which also keeps out other
+// processes using the same file. Everything done under the lock commits or
+// rolls back together, so a failed migration is never left dirty.
+func lockSQLite(ctx context.Context, conn *sql.Conn) (func(bool) error, error) {
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return nil, err
+	}
+	return func(failed bool) error {
+		stmt := "COMMIT"
+		if failed {
+			stmt = "ROLLBACK"
+		}
+		_, err := conn.ExecContext(context.Background(), stmt)
+		return err
+	}, nil
+}
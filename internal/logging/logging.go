@@ -0,0 +1,51 @@
+// Package logging builds the process-wide slog logger and carries a
+// per-request logger, enriched with the request ID and user, through the
+// gin context.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextKey holds the request-scoped *slog.Logger in the gin context.
+const contextKey = "logger"
+
+// New returns a logger writing to w. format is "json" or "text"; level is
+// debug, info, warn or error.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q (want json or text)", format)
+	}
+}
+
+// From returns the request's logger, or the default logger outside a
+// request.
+func From(c *gin.Context) *slog.Logger {
+	if value, ok := c.Get(contextKey); ok {
+		if logger, ok := value.(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// With adds attributes to the request's logger for the rest of the request.
+func With(c *gin.Context, args ...any) {
+	c.Set(contextKey, From(c).With(args...))
+}
@@ -0,0 +1,15 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMailer writes messages to the server log instead of sending them.
+// Intended for local development.
+type LogMailer struct{}
+
+func (LogMailer) Send(_ context.Context, msg Message) error {
+	slog.Info("mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
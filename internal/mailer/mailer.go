@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain-text messages to users.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer for driver: "smtp" or "log".
+func New(driver string, smtpCfg SMTPConfig) (Mailer, error) {
+	switch driver {
+	case "", "log":
+		return LogMailer{}, nil
+	case "smtp":
+		if smtpCfg.Addr == "" || smtpCfg.From == "" {
+			return nil, fmt.Errorf("smtp mailer requires SMTP_ADDR and MAIL_FROM")
+		}
+		return &SMTPMailer{Config: smtpCfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", driver)
+	}
+}
@@ -0,0 +1,174 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the stand-in server received in one connection.
+type smtpSession struct {
+	auth string
+	from string
+	rcpt []string
+	data string
+}
+
+// startSMTP runs a minimal SMTP server that accepts one message per
+// connection and reports it on the returned channel.
+func startSMTP(t *testing.T) (string, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, sessions)
+		}
+	}()
+	return ln.Addr().String(), sessions
+}
+
+func serveSMTP(conn net.Conn, sessions chan<- smtpSession) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	var s smtpSession
+
+	text.PrintfLine("220 stand-in ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			text.PrintfLine("250-stand-in")
+			text.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			s.auth = string(decoded)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = strings.TrimPrefix(arg, "FROM:")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, strings.TrimPrefix(arg, "TO:"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			sessions <- s
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, sessions := startSMTP(t)
+	m := &SMTPMailer{Config: SMTPConfig{Addr: addr, Username: "relay", Password: "secret", From: "chat@example.com"}}
+
+	err := m.Send(context.Background(), Message{
+		To:      "bob@example.com",
+		Subject: "Hello\r\nBcc: eve@example.com",
+		Body:    "line one\nline two\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s smtpSession
+	select {
+	case s = <-sessions:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the server received no message")
+	}
+	if s.auth != "\x00relay\x00secret" {
+		t.Errorf("AUTH PLAIN = %q", s.auth)
+	}
+	if s.from != "<chat@example.com>" || len(s.rcpt) != 1 || s.rcpt[0] != "<bob@example.com>" {
+		t.Errorf("envelope = %s -> %v", s.from, s.rcpt)
+	}
+
+	headers, body, ok := strings.Cut(s.data, "\n\n")
+	if !ok {
+		t.Fatalf("message has no header/body separator: %q", s.data)
+	}
+	for _, want := range []string{"From: chat@example.com", "To: bob@example.com", "Subject: HelloBcc: eve@example.com", "Content-Type: text/plain; charset=UTF-8"} {
+		if !strings.Contains(headers+"\n", want+"\n") {
+			t.Errorf("headers %q lack %q", headers, want)
+		}
+	}
+	for _, line := range strings.Split(headers, "\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("subject injected a header: %q", line)
+		}
+	}
+	if body != "line one\nline two\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPMailerSendHonorsContext(t *testing.T) {
+	// A server that accepts connections but never greets.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	m := &SMTPMailer{Config: SMTPConfig{Addr: ln.Addr().String(), From: "chat@example.com"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "bob@example.com", Subject: "hi", Body: "hi"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Send returned after %v", elapsed)
+	}
+
+	// The client must have hung up rather than leave the connection open.
+	var conn net.Conn
+	select {
+	case conn = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("the server saw no connection")
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("server read = %v, want EOF from a closed connection", err)
+	}
+}
@@ -3,18 +3,34 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/models"
 	"webFianlBackend/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 const (
-	ContextUserIDKey   = "userID"
-	ContextUsernameKey = "username"
+	ContextUserIDKey    = "userID"
+	ContextUsernameKey  = "username"
+	ContextSessionIDKey = "sessionID"
+	ContextVerifiedKey  = "emailVerified"
+	ContextAdminKey     = "isAdmin"
+	// ContextTokenScopesKey is only set for personal access tokens.
+	ContextTokenScopesKey = "tokenScopes"
 )
 
-func Auth(secret string) gin.HandlerFunc {
+// PersonalTokenPrefix marks bearer values that are personal access tokens
+// rather than session JWTs.
+const PersonalTokenPrefix = "pat_"
+
+// lastSeenInterval limits how often a session's last_seen_at is written.
+const lastSeenInterval = time.Minute
+
+func Auth(db *gorm.DB, keys *utils.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		tokenValue := ""
@@ -36,14 +52,145 @@ func Auth(secret string) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := utils.ParseToken(tokenValue, secret)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		if strings.HasPrefix(tokenValue, PersonalTokenPrefix) {
+			authenticatePersonalToken(c, db, tokenValue)
+		} else {
+			authenticateSession(c, db, tokenValue, keys)
+		}
+		if c.IsAborted() {
+			return
+		}
+		c.Next()
+	}
+}
+
+func authenticateSession(c *gin.Context, db *gorm.DB, tokenValue string, keys *utils.KeySet) {
+	claims, err := utils.ParseToken(tokenValue, keys)
+	if err != nil || claims.SessionID == "" || claims.Purpose != "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	now := time.Now()
+	var session models.Session
+	if err := db.WithContext(c).Where("id = ? AND user_id = ? AND expires_at > ?", claims.SessionID, claims.UserID, now).First(&session).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session expired or revoked"})
+		return
+	}
+
+	var user models.User
+	if err := db.WithContext(c).Select("id", "token_version", "email_verified_at", "is_admin", "suspended_at").Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "account not found"})
+		return
+	}
+	if user.TokenVersion != claims.Version {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "account suspended"})
+		return
+	}
+
+	if now.Sub(session.LastSeenAt) > lastSeenInterval {
+		if err := db.WithContext(c).Model(&session).Update("last_seen_at", now).Error; err != nil {
+			logging.From(c).Warn("update session last_seen_at failed", "error", err)
+		}
+	}
+
+	c.Set(ContextUserIDKey, claims.UserID)
+	c.Set(ContextUsernameKey, claims.Username)
+	c.Set(ContextSessionIDKey, session.ID)
+	c.Set(ContextVerifiedKey, user.EmailVerifiedAt != nil)
+	c.Set(ContextAdminKey, user.IsAdmin)
+	logging.With(c, "user_id", claims.UserID, "session_id", session.ID)
+}
+
+func authenticatePersonalToken(c *gin.Context, db *gorm.DB, tokenValue string) {
+	now := time.Now()
+	var token models.PersonalAccessToken
+	if err := db.WithContext(c).Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", utils.HashToken(tokenValue), now).
+		First(&token).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+
+	var user models.User
+	if err := db.WithContext(c).Select("id", "username", "email_verified_at", "suspended_at").Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "account not found"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "account suspended"})
+		return
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastSeenInterval {
+		if err := db.WithContext(c).Model(&token).Update("last_used_at", now).Error; err != nil {
+			logging.From(c).Warn("update token last_used_at failed", "token_id", token.ID, "error", err)
+		}
+	}
+
+	c.Set(ContextUserIDKey, user.ID)
+	c.Set(ContextUsernameKey, user.Username)
+	c.Set(ContextSessionIDKey, token.SessionKey())
+	c.Set(ContextVerifiedKey, user.EmailVerifiedAt != nil)
+	c.Set(ContextTokenScopesKey, token.Scopes)
+	logging.With(c, "user_id", user.ID, "token_id", token.ID)
+}
+
+// RequireScope rejects personal access tokens that were not granted scope.
+// Session logins pass unconditionally. It must run after Auth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(ContextTokenScopesKey)
+		if !ok {
+			c.Next()
+			return
+		}
+		scopes, _ := value.([]string)
+		for _, s := range scopes {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token lacks scope " + scope})
+	}
+}
+
+// RequireSession rejects personal access tokens, keeping account management
+// to interactive logins. It must run after Auth.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(ContextTokenScopesKey); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to personal access tokens"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail rejects users who have not confirmed their email
+// address. It must run after Auth.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool(ContextVerifiedKey) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email not verified"})
 			return
 		}
+		c.Next()
+	}
+}
 
-		c.Set(ContextUserIDKey, claims.UserID)
-		c.Set(ContextUsernameKey, claims.Username)
+// RequireAdmin limits a route to site administrators. Personal access tokens
+// never carry admin rights. It must run after Auth.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool(ContextAdminKey) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
 		c.Next()
 	}
 }
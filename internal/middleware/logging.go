@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"time"
+
+	"webFianlBackend/internal/logging"
+	"webFianlBackend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader     = "X-Request-ID"
+	ContextRequestIDKey = "requestID"
+)
+
+// validRequestID limits which incoming IDs are trusted, so a client cannot
+// inject arbitrary text into the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID reuses a well-formed X-Request-ID from the client or proxy,
+// otherwise generates one, echoes it in the response, and starts the
+// request's logger with it and the trace ID, if any.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id, _ = utils.RandomToken(8)
+		}
+		c.Set(ContextRequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		logging.With(c, "request_id", id)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			logging.With(c, "trace_id", span.TraceID().String())
+		}
+		c.Next()
+	}
+}
+
+// AccessLog writes one line per request once it has been handled, so the
+// user ID added by Auth is included. Successful requests to quietPaths, such
+// as probes, are logged at debug level.
+func AccessLog(quietPaths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case slices.Contains(quietPaths, c.Request.URL.Path):
+			level = slog.LevelDebug
+		}
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", c.ClientIP(),
+			"bytes", c.Writer.Size(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+		logging.From(c).Log(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 and logs it with the stack trace.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if err := recover(); err != nil {
+				logging.From(c).Error("panic recovered",
+					"error", fmt.Sprint(err),
+					"stack", string(debug.Stack()))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+			}
+		}()
+		c.Next()
+	}
+}
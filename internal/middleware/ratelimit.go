@@ -6,6 +6,8 @@ import (
 	"sync"
 	"time"
 
+	"webFianlBackend/internal/metrics"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -52,6 +54,7 @@ func RateLimit(rl *RateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := clientIP(c)
 		if !rl.Allow(ip) {
+			metrics.RateLimited.WithLabelValues(metrics.Route(c)).Inc()
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
 			return
 		}
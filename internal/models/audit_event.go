@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AuditEvent is one entry of the append-only audit trail. Rows are never
+// updated or deleted by the application, and carry no foreign keys so they
+// outlive the users and channels they mention.
+type AuditEvent struct {
+	ID           uint                   `gorm:"primaryKey" json:"id"`
+	Action       string                 `gorm:"size:64;index;not null" json:"action"`
+	ActorID      *uint                  `gorm:"index" json:"actor_id"`
+	ActorName    string                 `gorm:"size:64" json:"actor_name"`
+	TargetUserID *uint                  `gorm:"index" json:"target_user_id"`
+	ChannelID    *uint                  `gorm:"index" json:"channel_id"`
+	IP           string                 `gorm:"size:64" json:"ip"`
+	UserAgent    string                 `gorm:"size:255" json:"user_agent"`
+	Metadata     map[string]interface{} `gorm:"type:text;serializer:json" json:"metadata,omitempty"`
+	CreatedAt    time.Time              `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scopes a personal access token can be granted. Session logins implicitly
+// hold all of them.
+const (
+	ScopeChannelsRead   = "channels:read"
+	ScopeMessagesWrite  = "messages:write"
+	ScopeChannelsManage = "channels:manage"
+)
+
+var TokenScopes = []string{ScopeChannelsRead, ScopeMessagesWrite, ScopeChannelsManage}
+
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"-"`
+	Name       string     `gorm:"size:64;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     []string   `gorm:"size:255;serializer:json;not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SessionKey identifies connections opened with this token, in the same
+// namespace as session IDs, so they can be closed when it is revoked.
+func (t PersonalAccessToken) SessionKey() string {
+	return fmt.Sprintf("pat:%d", t.ID)
+}
+
+func (t PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
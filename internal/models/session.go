@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string    `gorm:"primaryKey;size:64" json:"id"`
+	UserID     uint      `gorm:"index;not null" json:"-"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+}
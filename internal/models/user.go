@@ -1,11 +1,39 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"webFianlBackend/internal/utils"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
-	Email     string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
-	Password  string    `gorm:"size:255;not null" json:"-"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	Username          string     `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Email             string     `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	UsernameKey       string     `gorm:"column:username_normalized;size:64;uniqueIndex;not null" json:"-"`
+	EmailKey          string     `gorm:"column:email_normalized;size:255;uniqueIndex;not null" json:"-"`
+	Password          string     `gorm:"size:255;not null" json:"-"`
+	TokenVersion      uint       `gorm:"not null;default:0" json:"-"`
+	EmailVerifiedAt   *time.Time `json:"email_verified_at"`
+	TOTPSecret        string     `gorm:"column:totp_secret;size:64" json:"-"`
+	TOTPEnabled       bool       `gorm:"column:totp_enabled;not null;default:false" json:"totp_enabled"`
+	TOTPLastStep      int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	FailedLogins      int        `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt *time.Time `json:"-"`
+	LockedUntil       *time.Time `json:"-"`
+	IsAdmin           bool       `gorm:"not null;default:false" json:"is_admin"`
+	SuspendedAt       *time.Time `json:"suspended_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// BeforeSave keeps the normalized lookup columns in step with the display
+// values on every create and save.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.Username = utils.NormalizeIdentity(u.Username)
+	u.Email = utils.NormalizeIdentity(u.Email)
+	u.UsernameKey = utils.IdentityKey(u.Username)
+	u.EmailKey = utils.IdentityKey(u.Email)
+	return nil
 }
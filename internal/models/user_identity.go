@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Issuer    string    `gorm:"size:255;index:idx_issuer_subject,unique;not null" json:"issuer"`
+	Subject   string    `gorm:"size:255;index:idx_issuer_subject,unique;not null" json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
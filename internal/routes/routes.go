@@ -1,21 +1,46 @@
 package routes
 
 import (
+	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"webFianlBackend/internal/config"
 	"webFianlBackend/internal/controllers"
+	"webFianlBackend/internal/mailer"
+	"webFianlBackend/internal/metrics"
 	"webFianlBackend/internal/middleware"
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/service"
+	"webFianlBackend/internal/store"
+	"webFianlBackend/internal/utils"
+	"webFianlBackend/internal/validation"
 	"webFianlBackend/internal/ws"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 )
 
-func SetupRouter(db *gorm.DB, jwtSecret string, corsOrigins string) *gin.Engine {
-	router := gin.Default()
-	origins := strings.Split(corsOrigins, ",")
+func SetupRouter(db *gorm.DB, cfg config.Config, keys *utils.KeySet, mail mailer.Mailer, policy *validation.Policy, manager *ws.Manager) *gin.Engine {
+	router := gin.New()
+	// Lets handlers pass the gin context to GORM so queries join the
+	// request's trace.
+	router.ContextWithFallback = true
+	// Scrapes and probes are neither traced nor logged above debug level.
+	quietPaths := []string{"/metrics", "/healthz", "/readyz"}
+	router.Use(
+		otelgin.Middleware(cfg.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+			return !slices.Contains(quietPaths, r.URL.Path)
+		})),
+		middleware.RequestID(),
+		middleware.AccessLog(quietPaths...),
+		middleware.Recovery(),
+		metrics.Middleware(),
+	)
+	origins := strings.Split(cfg.CORSOrigins, ",")
 	for i := range origins {
 		origins[i] = strings.TrimSpace(origins[i])
 	}
@@ -28,43 +53,178 @@ func SetupRouter(db *gorm.DB, jwtSecret string, corsOrigins string) *gin.Engine
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Authorization", "Content-Type", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	cookies := controllers.CookieOptions{
+		Secure:   cfg.CookieSecure,
+		Domain:   cfg.CookieDomain,
+		SameSite: cfg.SameSite(),
+	}
+	stores := store.NewGorm(db)
 	authController := &controllers.AuthController{
-		DB:        db,
-		JWTSecret: jwtSecret,
+		Users:      stores.Users,
+		Accounts:   stores.Accounts,
+		Logins:     stores.Logins,
+		Sessions:   stores.Sessions,
+		Audit:      stores.Audit,
+		Keys:       keys,
+		Policy:     policy,
+		Manager:    manager,
+		Mailer:     mail,
+		AppURL:     cfg.AppURL,
+		TOTPIssuer: cfg.TOTPIssuer,
+		TokenTTL:   cfg.TokenTTL,
+		Cookies:    cookies,
+	}
+	sessionController := &controllers.SessionController{
+		Sessions: stores.Sessions,
+		Audit:    stores.Audit,
+		Manager:  manager,
+		Cookies:  cookies,
+	}
+	tokenController := &controllers.TokenController{
+		Tokens:  stores.Tokens,
+		Audit:   stores.Audit,
+		Manager: manager,
+	}
+	channels := &service.Channels{
+		Store:    stores,
+		Presence: manager,
+	}
+	channelController := &controllers.ChannelController{
+		Audit:    stores.Audit,
+		Channels: channels,
+		Manager:  manager,
 	}
-	channelController := &controllers.ChannelController{DB: db}
+	auditController := &controllers.AuditController{Audit: stores.Audit, Channels: channels}
 	wsController := &controllers.WSController{
-		DB:      db,
-		Manager: ws.NewManager(),
+		Channels:       channels,
+		Manager:        manager,
 		AllowedOrigins: originMap,
 	}
 
 	api := router.Group("/api")
-	authLimiter := middleware.NewRateLimiter(10, 5*time.Minute)
+	authLimiter := middleware.NewRateLimiter(cfg.RateLimitAuth, cfg.RateLimitAuthWindow)
 	api.POST("/register", middleware.RateLimit(authLimiter), authController.Register)
 	api.POST("/login", middleware.RateLimit(authLimiter), authController.Login)
+	api.POST("/login/2fa", middleware.RateLimit(authLimiter), authController.LoginTwoFactor)
+	if cfg.OIDCIssuer != "" {
+		oidcController := &controllers.OIDCController{
+			Auth:         authController,
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			PostLoginURL: cfg.OIDCPostLoginURL,
+		}
+		api.GET("/auth/oidc/login", middleware.RateLimit(authLimiter), oidcController.Login)
+		api.GET("/auth/oidc/callback", oidcController.Callback)
+	}
+	// The mailed links open confirmation pages; only the POSTs spend tokens.
+	api.GET("/verify-email", middleware.RateLimit(authLimiter), authController.VerifyEmailPage)
+	api.POST("/verify-email", middleware.RateLimit(authLimiter), authController.VerifyEmail)
+	api.GET("/unlock", middleware.RateLimit(authLimiter), authController.UnlockPage)
+	api.POST("/unlock", middleware.RateLimit(authLimiter), authController.Unlock)
+	resetLimiter := middleware.NewRateLimiter(cfg.RateLimitReset, cfg.RateLimitResetWindow)
+	api.POST("/password/forgot", middleware.RateLimit(resetLimiter), authController.ForgotPassword)
+	api.POST("/password/reset", middleware.RateLimit(resetLimiter), authController.ResetPassword)
+
+	// Actions listed in UNVERIFIED_RESTRICTIONS require a verified email.
+	restricted := make(map[string]bool)
+	for _, action := range cfg.UnverifiedRestrictions {
+		restricted[action] = true
+	}
+	requireVerified := func(action string) gin.HandlerFunc {
+		if restricted[action] {
+			return middleware.RequireVerifiedEmail()
+		}
+		return func(c *gin.Context) { c.Next() }
+	}
+	mailLimiter := middleware.NewRateLimiter(cfg.RateLimitMail, cfg.RateLimitMailWindow)
+
+	readChannels := middleware.RequireScope(models.ScopeChannelsRead)
+	manageChannels := middleware.RequireScope(models.ScopeChannelsManage)
 
 	authGroup := api.Group("")
-	authGroup.Use(middleware.Auth(jwtSecret))
-	authGroup.GET("/channels", channelController.ListMine)
-	authGroup.GET("/channels/joined", channelController.ListJoined)
-	authGroup.POST("/channels", channelController.Create)
-	authGroup.GET("/channels/search", channelController.Search)
-	authGroup.POST("/channels/:id/join", channelController.Join)
-	authGroup.GET("/channels/:id/members", channelController.ListMembers)
-	authGroup.DELETE("/channels/:id", channelController.Delete)
+	authGroup.Use(middleware.Auth(db, keys))
+	authGroup.GET("/channels", readChannels, channelController.ListMine)
+	authGroup.GET("/channels/joined", readChannels, channelController.ListJoined)
+	authGroup.POST("/channels", manageChannels, requireVerified("create_channel"), channelController.Create)
+	authGroup.GET("/channels/search", readChannels, channelController.Search)
+	authGroup.POST("/channels/:id/join", manageChannels, requireVerified("join_channel"), channelController.Join)
+	authGroup.GET("/channels/:id/members", readChannels, channelController.ListMembers)
+	authGroup.GET("/channels/:id/online", readChannels, channelController.ListOnline)
+	authGroup.DELETE("/channels/:id", manageChannels, channelController.Delete)
+	authGroup.GET("/channels/:id/audit", readChannels, auditController.ListChannel)
 	authGroup.GET("/me", authController.Me)
-	authGroup.PUT("/me", authController.UpdateMe)
-	authGroup.DELETE("/me", authController.DeleteMe)
-	authGroup.POST("/logout", authController.Logout)
 
-	router.GET("/ws/:id", middleware.Auth(jwtSecret), wsController.Serve)
+	// Account management is limited to interactive sessions.
+	sessionGroup := authGroup.Group("")
+	sessionGroup.Use(middleware.RequireSession())
+	sessionGroup.PUT("/me", authController.UpdateMe)
+	sessionGroup.DELETE("/me", authController.DeleteMe)
+	sessionGroup.GET("/me/sessions", sessionController.List)
+	sessionGroup.DELETE("/me/sessions", sessionController.RevokeOthers)
+	sessionGroup.DELETE("/me/sessions/:id", sessionController.Revoke)
+	sessionGroup.GET("/me/tokens", tokenController.List)
+	sessionGroup.POST("/me/tokens", tokenController.Create)
+	sessionGroup.DELETE("/me/tokens/:id", tokenController.Revoke)
+	sessionGroup.POST("/me/2fa/enroll", authController.EnrollTwoFactor)
+	sessionGroup.POST("/me/2fa/confirm", authController.ConfirmTwoFactor)
+	sessionGroup.DELETE("/me/2fa", authController.DisableTwoFactor)
+	sessionGroup.POST("/me/verify-email", middleware.RateLimit(mailLimiter), authController.ResendVerification)
+	sessionGroup.POST("/logout", authController.Logout)
+
+	// Site administration. is_admin is granted directly in the database.
+	adminController := &controllers.AdminController{
+		Users:    stores.Users,
+		Accounts: stores.Accounts,
+		Logins:   stores.Logins,
+		Audit:    stores.Audit,
+		Channels: channels,
+		Manager:  manager,
+	}
+	adminGroup := sessionGroup.Group("/admin")
+	adminGroup.Use(middleware.RequireAdmin())
+	adminGroup.GET("/users", adminController.ListUsers)
+	adminGroup.GET("/users/:id", adminController.GetUser)
+	adminGroup.POST("/users/:id/suspend", adminController.Suspend)
+	adminGroup.POST("/users/:id/unsuspend", adminController.Unsuspend)
+	adminGroup.POST("/users/:id/unlock", adminController.Unlock)
+	adminGroup.POST("/users/:id/disconnect", adminController.DisconnectUser)
+	adminGroup.DELETE("/channels/:id", adminController.DeleteChannel)
+	adminGroup.GET("/connections", adminController.ListHubs)
+	adminGroup.GET("/connections/channels/:id", adminController.ListHubClients)
+	adminGroup.DELETE("/connections/:id", adminController.DisconnectLocalClient)
+	adminGroup.GET("/stats", adminController.Stats)
+	adminGroup.GET("/audit", auditController.ListAll)
+
+	if cfg.MetricsAddr == "" {
+		router.GET("/metrics", gin.WrapH(metrics.Handler(cfg.MetricsToken)))
+	}
+
+	healthController := &controllers.HealthController{
+		DB:               db,
+		Manager:          manager,
+		CheckBroadcaster: cfg.Broadcaster != "memory",
+	}
+	router.GET("/healthz", healthController.Live)
+	router.GET("/readyz", healthController.Ready)
+
+	keysController := &controllers.KeysController{Keys: keys}
+	router.GET("/.well-known/jwks.json", keysController.JWKS)
+
+	router.GET("/ws/:id",
+		middleware.Auth(db, keys),
+		middleware.RequireScope(models.ScopeMessagesWrite),
+		requireVerified("chat"),
+		wsController.Serve,
+	)
 
 	return router
 }
@@ -0,0 +1,166 @@
+// Package service holds the business rules of the chat server on top of
+// package store, independent of HTTP and of the storage implementation.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+)
+
+// The errors are meant to be shown to the client as they are.
+var (
+	ErrChannelNotFound     = errors.New("channel not found")
+	ErrOwnerNotFound       = errors.New("owner not found")
+	ErrChannelExists       = errors.New("channel already exists")
+	ErrNotMember           = errors.New("not a member")
+	ErrNotOwner            = errors.New("not the owner")
+	ErrInvalidQuery        = errors.New("query must be owner@channel")
+	ErrPresenceUnavailable = errors.New("presence unavailable")
+)
+
+// Presence reports who is connected to a channel; ws.Manager implements it.
+type Presence interface {
+	Online(ctx context.Context, channelID uint) ([]uint, error)
+}
+
+// Channels manages channels and who may use them. A channel can be used by
+// its owner and its members; the owner is a member from creation, but is
+// authorized by owner_id so a missing membership row never locks them out.
+type Channels struct {
+	Store    store.Store
+	Presence Presence
+}
+
+// Owned lists the channels userID owns.
+func (s *Channels) Owned(ctx context.Context, userID uint) ([]models.Channel, error) {
+	return s.Store.Channels.Owned(ctx, userID)
+}
+
+// Joined lists the channels userID has joined but does not own.
+func (s *Channels) Joined(ctx context.Context, userID uint) ([]models.Channel, error) {
+	return s.Store.Channels.Joined(ctx, userID)
+}
+
+// Create creates a channel owned by userID.
+func (s *Channels) Create(ctx context.Context, userID uint, name string) (models.Channel, error) {
+	channel := models.Channel{Name: name, OwnerID: userID}
+	err := s.Store.Channels.Create(ctx, &channel)
+	if errors.Is(err, store.ErrConflict) {
+		return channel, ErrChannelExists
+	}
+	return channel, err
+}
+
+// Search finds a channel by a query of the form "owner@channel".
+func (s *Channels) Search(ctx context.Context, query string) (models.Channel, error) {
+	ownerName, channelName, ok := strings.Cut(query, "@")
+	if !ok || ownerName == "" || channelName == "" {
+		return models.Channel{}, ErrInvalidQuery
+	}
+
+	owner, err := s.Store.Users.ByUsername(ctx, ownerName)
+	if errors.Is(err, store.ErrNotFound) {
+		return models.Channel{}, ErrOwnerNotFound
+	}
+	if err != nil {
+		return models.Channel{}, err
+	}
+	channel, err := s.Store.Channels.Find(ctx, owner.ID, channelName)
+	return channel, notFound(err)
+}
+
+// Join makes userID a member of a channel. Any user may join any channel
+// they can name.
+func (s *Channels) Join(ctx context.Context, userID, channelID uint) (models.Channel, error) {
+	channel, err := s.get(ctx, channelID)
+	if err != nil {
+		return channel, err
+	}
+	if err := s.Store.Memberships.Add(ctx, channel.ID, userID); err != nil {
+		return channel, fmt.Errorf("add membership: %w", err)
+	}
+	return channel, nil
+}
+
+// Access returns a channel if userID may read and post in it.
+func (s *Channels) Access(ctx context.Context, userID, channelID uint) (models.Channel, error) {
+	channel, err := s.get(ctx, channelID)
+	if err != nil || channel.OwnerID == userID {
+		return channel, err
+	}
+	member, err := s.Store.Memberships.IsMember(ctx, channel.ID, userID)
+	if err != nil {
+		return channel, err
+	}
+	if !member {
+		return channel, ErrNotMember
+	}
+	return channel, nil
+}
+
+// Members lists a channel's members to one of them.
+func (s *Channels) Members(ctx context.Context, userID, channelID uint) ([]models.User, error) {
+	channel, err := s.Access(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Memberships.Members(ctx, channel.ID)
+}
+
+// Online lists the members connected to a channel, on any server instance,
+// to one of them.
+func (s *Channels) Online(ctx context.Context, userID, channelID uint) ([]models.User, error) {
+	channel, err := s.Access(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.Presence.Online(ctx, channel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPresenceUnavailable, err)
+	}
+	return s.Store.Users.Names(ctx, ids)
+}
+
+// Owner returns a channel if userID owns it.
+func (s *Channels) Owner(ctx context.Context, userID, channelID uint) (models.Channel, error) {
+	channel, err := s.get(ctx, channelID)
+	if err == nil && channel.OwnerID != userID {
+		err = ErrNotOwner
+	}
+	return channel, err
+}
+
+// Delete removes a channel owned by userID.
+func (s *Channels) Delete(ctx context.Context, userID, channelID uint) (models.Channel, error) {
+	channel, err := s.Owner(ctx, userID, channelID)
+	if err != nil {
+		return channel, err
+	}
+	return channel, s.Store.Channels.Delete(ctx, channel.ID)
+}
+
+// ForceDelete removes any channel regardless of owner, for administrators.
+func (s *Channels) ForceDelete(ctx context.Context, channelID uint) (models.Channel, error) {
+	channel, err := s.get(ctx, channelID)
+	if err != nil {
+		return channel, err
+	}
+	return channel, s.Store.Channels.Delete(ctx, channel.ID)
+}
+
+func (s *Channels) get(ctx context.Context, channelID uint) (models.Channel, error) {
+	channel, err := s.Store.Channels.Get(ctx, channelID)
+	return channel, notFound(err)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrChannelNotFound
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/store"
+)
+
+type fixedPresence []uint
+
+func (p fixedPresence) Online(ctx context.Context, channelID uint) ([]uint, error) {
+	return p, nil
+}
+
+// newTestChannels returns a service over an in-memory store holding alice,
+// bob and carol, and a channel "general" owned by alice.
+func newTestChannels(t *testing.T) (*Channels, models.Channel, map[string]models.User) {
+	t.Helper()
+	ctx := context.Background()
+	s := &Channels{Store: store.NewMemory().Store()}
+
+	users := map[string]models.User{}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := models.User{Username: name, Email: name + "@example.com"}
+		if err := s.Store.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+
+	channel, err := s.Create(ctx, users["alice"].ID, "general")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, channel, users
+}
+
+func TestAccess(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+	if _, err := s.Join(ctx, users["bob"].ID, channel.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    uint
+		channelID uint
+		want      error
+	}{
+		{"owner", users["alice"].ID, channel.ID, nil},
+		{"member", users["bob"].ID, channel.ID, nil},
+		{"stranger", users["carol"].ID, channel.ID, ErrNotMember},
+		{"missing channel", users["alice"].ID, channel.ID + 100, ErrChannelNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Access(ctx, tt.userID, tt.channelID)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Access = %v, want %v", err, tt.want)
+			}
+			if err == nil && (got.ID != channel.ID || got.Owner.Username != "alice") {
+				t.Fatalf("Access returned %+v", got)
+			}
+		})
+	}
+}
+
+func TestOwnerWithoutMembership(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+
+	// The owner is authorized by owner_id, not by the membership row.
+	s.Store = store.Store{Users: s.Store.Users, Channels: s.Store.Channels, Memberships: noMembers{s.Store.Memberships}}
+	if _, err := s.Access(ctx, users["alice"].ID, channel.ID); err != nil {
+		t.Fatalf("owner Access = %v", err)
+	}
+	if _, err := s.Owner(ctx, users["alice"].ID, channel.ID); err != nil {
+		t.Fatalf("Owner = %v", err)
+	}
+}
+
+// noMembers reports nobody as a member.
+type noMembers struct {
+	store.Memberships
+}
+
+func (noMembers) IsMember(ctx context.Context, channelID, userID uint) (bool, error) {
+	return false, nil
+}
+
+func TestOwner(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+	if _, err := s.Join(ctx, users["bob"].ID, channel.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Owner(ctx, users["alice"].ID, channel.ID); err != nil {
+		t.Fatalf("owner: %v", err)
+	}
+	if _, err := s.Owner(ctx, users["bob"].ID, channel.ID); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("member: %v, want ErrNotOwner", err)
+	}
+	if _, err := s.Owner(ctx, users["alice"].ID, channel.ID+100); !errors.Is(err, ErrChannelNotFound) {
+		t.Fatalf("missing channel: %v, want ErrChannelNotFound", err)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+	if _, err := s.Join(ctx, users["bob"].ID, channel.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	members, err := s.Members(ctx, users["bob"].ID, channel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, member := range members {
+		names = append(names, member.Username)
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Fatalf("Members = %v, want [alice bob]", names)
+	}
+
+	if _, err := s.Members(ctx, users["carol"].ID, channel.ID); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("stranger: %v, want ErrNotMember", err)
+	}
+}
+
+func TestOnline(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+	s.Presence = fixedPresence{users["alice"].ID, users["carol"].ID + 100}
+
+	online, err := s.Online(ctx, users["alice"].ID, channel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(online) != 1 || online[0].Username != "alice" {
+		t.Fatalf("Online = %+v, want only alice", online)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	s, channel, users := newTestChannels(t)
+	if _, err := s.Join(ctx, users["bob"].ID, channel.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Delete(ctx, users["bob"].ID, channel.ID); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("member Delete = %v, want ErrNotOwner", err)
+	}
+	if _, err := s.Access(ctx, users["bob"].ID, channel.ID); err != nil {
+		t.Fatalf("channel gone after a refused Delete: %v", err)
+	}
+
+	deleted, err := s.Delete(ctx, users["alice"].ID, channel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.ID != channel.ID {
+		t.Fatalf("Delete returned channel %d, want %d", deleted.ID, channel.ID)
+	}
+	if _, err := s.Access(ctx, users["alice"].ID, channel.ID); !errors.Is(err, ErrChannelNotFound) {
+		t.Fatalf("Access after Delete = %v, want ErrChannelNotFound", err)
+	}
+	joined, err := s.Joined(ctx, users["bob"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(joined) != 0 {
+		t.Fatalf("bob still in %d channels", len(joined))
+	}
+
+	// The name is free again.
+	if _, err := s.Create(ctx, users["alice"].ID, "general"); err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if _, err := s.Create(ctx, users["alice"].ID, "general"); !errors.Is(err, ErrChannelExists) {
+		t.Fatalf("duplicate Create = %v, want ErrChannelExists", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	s, channel, _ := newTestChannels(t)
+
+	got, err := s.Search(ctx, "ALICE@general")
+	if err != nil || got.ID != channel.ID {
+		t.Fatalf("Search = %+v, %v", got, err)
+	}
+	for query, want := range map[string]error{
+		"general":      ErrInvalidQuery,
+		"@general":     ErrInvalidQuery,
+		"dave@general": ErrOwnerNotFound,
+		"alice@random": ErrChannelNotFound,
+	} {
+		if _, err := s.Search(ctx, query); !errors.Is(err, want) {
+			t.Errorf("Search(%q) = %v, want %v", query, err, want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// NewGorm returns stores backed by db. db must be opened with
+// TranslateError so that unique key violations become ErrConflict.
+func NewGorm(db *gorm.DB) Store {
+	return Store{
+		Users:       gormUsers{db: db},
+		Channels:    gormChannels{db: db},
+		Memberships: gormMemberships{db: db},
+		Accounts:    gormAccounts{db: db},
+		Logins:      gormLogins{db: db},
+		Sessions:    gormSessions{db: db},
+		Tokens:      gormTokens{db: db},
+		Audit:       gormAudit{db: db},
+	}
+}
+
+// translate maps GORM's errors onto the package's.
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrConflict
+	}
+	return err
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (s gormUsers) ByID(ctx context.Context, id uint) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	return user, translate(err)
+}
+
+func (s gormUsers) ByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("username_normalized = ?", utils.IdentityKey(username)).First(&user).Error
+	return user, translate(err)
+}
+
+func (s gormUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Where("email_normalized = ?", utils.IdentityKey(email)).First(&user).Error
+	return user, translate(err)
+}
+
+func (s gormUsers) Names(ctx context.Context, ids []uint) ([]models.User, error) {
+	users := []models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := s.db.WithContext(ctx).Select("id", "username").Where("id IN ?", ids).Order("username").Find(&users).Error
+	return users, err
+}
+
+func (s gormUsers) Create(ctx context.Context, user *models.User) error {
+	return translate(s.db.WithContext(ctx).Create(user).Error)
+}
+
+type gormChannels struct {
+	db *gorm.DB
+}
+
+func (s gormChannels) Get(ctx context.Context, id uint) (models.Channel, error) {
+	var channel models.Channel
+	err := s.db.WithContext(ctx).Where("id = ?", id).Preload("Owner").First(&channel).Error
+	return channel, translate(err)
+}
+
+func (s gormChannels) Find(ctx context.Context, ownerID uint, name string) (models.Channel, error) {
+	var channel models.Channel
+	err := s.db.WithContext(ctx).Where("owner_id = ? AND name = ?", ownerID, name).Preload("Owner").First(&channel).Error
+	return channel, translate(err)
+}
+
+func (s gormChannels) Owned(ctx context.Context, userID uint) ([]models.Channel, error) {
+	var channels []models.Channel
+	err := s.db.WithContext(ctx).Where("owner_id = ?", userID).Preload("Owner").Find(&channels).Error
+	return channels, err
+}
+
+func (s gormChannels) Joined(ctx context.Context, userID uint) ([]models.Channel, error) {
+	var channels []models.Channel
+	err := s.db.WithContext(ctx).
+		Joins("JOIN channel_members ON channel_members.channel_id = channels.id").
+		Where("channel_members.user_id = ? AND channels.owner_id <> ?", userID, userID).
+		Preload("Owner").
+		Find(&channels).Error
+	return channels, err
+}
+
+func (s gormChannels) Create(ctx context.Context, channel *models.Channel) error {
+	return translate(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(channel).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ChannelMember{ChannelID: channel.ID, UserID: channel.OwnerID}).Error
+	}))
+}
+
+func (s gormChannels) Delete(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("channel_id = ?", id).Delete(&models.ChannelMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Channel{}, id).Error
+	})
+}
+
+type gormMemberships struct {
+	db *gorm.DB
+}
+
+func (s gormMemberships) Add(ctx context.Context, channelID, userID uint) error {
+	return s.db.WithContext(ctx).FirstOrCreate(&models.ChannelMember{}, models.ChannelMember{
+		ChannelID: channelID,
+		UserID:    userID,
+	}).Error
+}
+
+func (s gormMemberships) IsMember(ctx context.Context, channelID, userID uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.ChannelMember{}).
+		Where("channel_id = ? AND user_id = ?", channelID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s gormMemberships) Members(ctx context.Context, channelID uint) ([]models.User, error) {
+	var members []models.User
+	err := s.db.WithContext(ctx).Table("users").
+		Select("users.id, users.username, users.email, users.created_at").
+		Joins("JOIN channel_members ON channel_members.user_id = users.id").
+		Where("channel_members.channel_id = ?", channelID).
+		Order("users.username").
+		Find(&members).Error
+	return members, err
+}
+
+type gormSessions struct {
+	db *gorm.DB
+}
+
+func (s gormSessions) Create(ctx context.Context, session *models.Session) error {
+	return s.db.WithContext(ctx).Create(session).Error
+}
+
+func (s gormSessions) Active(ctx context.Context, userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.WithContext(ctx).Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (s gormSessions) Delete(ctx context.Context, userID uint, id string) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&models.Session{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
+
+func (s gormSessions) DeleteOthers(ctx context.Context, userID uint, keep string) ([]string, error) {
+	var ids []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ?", userID, keep).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Session{}).Error
+	})
+	return ids, err
+}
+
+type gormTokens struct {
+	db *gorm.DB
+}
+
+func (s gormTokens) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	return s.db.WithContext(ctx).Create(token).Error
+}
+
+func (s gormTokens) List(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (s gormTokens) Delete(ctx context.Context, userID, id uint) (models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&token).Error
+	})
+	return token, translate(err)
+}
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+func (s gormAudit) Append(ctx context.Context, event *models.AuditEvent) error {
+	return s.db.WithContext(ctx).Create(event).Error
+}
+
+func (s gormAudit) List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	query := s.where(ctx, filter)
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	events := []models.AuditEvent{}
+	err := query.Order("id DESC").Find(&events).Error
+	return events, err
+}
+
+func (s gormAudit) Count(ctx context.Context, filter AuditFilter) (int64, error) {
+	var n int64
+	err := s.where(ctx, filter).Count(&n).Error
+	return n, err
+}
+
+func (s gormAudit) where(ctx context.Context, filter AuditFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.AuditEvent{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	for column, id := range map[string]uint{
+		"actor_id":       filter.ActorID,
+		"target_user_id": filter.TargetUserID,
+		"channel_id":     filter.ChannelID,
+	} {
+		if id != 0 {
+			query = query.Where(column+" = ?", id)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	return query
+}
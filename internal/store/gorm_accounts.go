@@ -0,0 +1,437 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"webFianlBackend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormAccounts struct {
+	db *gorm.DB
+}
+
+func (s gormAccounts) ByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN user_identities ON user_identities.user_id = users.id").
+		Where("user_identities.issuer = ? AND user_identities.subject = ?", issuer, subject).
+		First(&user).Error
+	return user, translate(err)
+}
+
+func (s gormAccounts) Link(ctx context.Context, user *models.User, identity *models.UserIdentity) error {
+	return translate(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if user.ID == 0 {
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	}))
+}
+
+func (s gormAccounts) UpdateProfile(ctx context.Context, user *models.User, signOut bool, keep string) ([]string, error) {
+	var revoked []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if signOut {
+			user.TokenVersion++
+			var err error
+			if revoked, err = revokeAccess(tx, user.ID, keep); err != nil {
+				return err
+			}
+		}
+		return tx.Save(user).Error
+	})
+	return revoked, translate(err)
+}
+
+func (s gormAccounts) Delete(ctx context.Context, userID uint) ([]uint, []string, error) {
+	var channelIDs []uint
+	var revoked []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if revoked, err = revokeAccess(tx, userID, ""); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.EmailVerification{}, &models.PasswordReset{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.AccountUnlock{}} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.Channel{}).Where("owner_id = ?", userID).Pluck("id", &channelIDs).Error; err != nil {
+			return err
+		}
+		if len(channelIDs) > 0 {
+			if err := tx.Where("channel_id IN ?", channelIDs).Delete(&models.ChannelMember{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", channelIDs).Delete(&models.Channel{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.ChannelMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	return channelIDs, revoked, err
+}
+
+func (s gormAccounts) Suspend(ctx context.Context, userID uint) ([]string, error) {
+	var revoked []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Bumping the token version also voids a pending two-factor login.
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"suspended_at":  time.Now(),
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		if revoked, err = revokeSessions(tx, userID, ""); err != nil {
+			return err
+		}
+		keys, err := tokenKeys(tx, userID)
+		revoked = append(revoked, keys...)
+		return err
+	})
+	return revoked, err
+}
+
+func (s gormAccounts) Unsuspend(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("suspended_at", nil).Error
+}
+
+func (s gormAccounts) AddVerification(ctx context.Context, verification *models.EmailVerification) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", verification.UserID).Delete(&models.EmailVerification{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(verification).Error
+	})
+}
+
+func (s gormAccounts) VerifyEmail(ctx context.Context, tokenHash string) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var verification models.EmailVerification
+		if err := tx.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&verification).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", verification.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		// The address changed after the link was sent.
+		if user.Email != verification.Email {
+			return ErrNotFound
+		}
+		now := time.Now()
+		if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+		user.EmailVerifiedAt = &now
+		return tx.Where("user_id = ?", user.ID).Delete(&models.EmailVerification{}).Error
+	})
+	return user, translate(err)
+}
+
+func (s gormAccounts) AddPasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	return s.db.WithContext(ctx).Create(reset).Error
+}
+
+func (s gormAccounts) PasswordResetUser(ctx context.Context, tokenHash string) (models.User, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).
+		Joins("JOIN password_resets ON password_resets.user_id = users.id").
+		Where("password_resets.token_hash = ? AND password_resets.used_at IS NULL AND password_resets.expires_at > ?", tokenHash, time.Now()).
+		First(&user).Error
+	return user, translate(err)
+}
+
+func (s gormAccounts) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (models.User, []string, error) {
+	var user models.User
+	var revoked []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, time.Now()).
+			First(&reset).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", reset.UserID).First(&user).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		user.Password = passwordHash
+		user.TokenVersion++
+		user.FailedLogins = 0
+		user.LastFailedLoginAt = nil
+		user.LockedUntil = nil
+		// The link was delivered to the account's address, which proves it.
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AccountUnlock{}).Error; err != nil {
+			return err
+		}
+		var err error
+		revoked, err = revokeAccess(tx, user.ID, "")
+		return err
+	})
+	return user, revoked, translate(err)
+}
+
+func (s gormAccounts) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	query := s.db.WithContext(ctx).Model(&models.User{})
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("username_normalized LIKE ? ESCAPE '!' OR email_normalized LIKE ? ESCAPE '!'", pattern, pattern)
+	}
+	if filter.Suspended {
+		query = query.Where("suspended_at IS NOT NULL")
+	}
+	if filter.Locked {
+		query = query.Where("locked_until > ?", time.Now())
+	}
+	if filter.Admin {
+		query = query.Where("is_admin = ?", true)
+	}
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	users := []models.User{}
+	err := query.Order("id DESC").Find(&users).Error
+	return users, err
+}
+
+func (s gormAccounts) Usage(ctx context.Context, userID uint) (UserUsage, error) {
+	var usage UserUsage
+	err := count(map[*int64]*gorm.DB{
+		&usage.OwnedChannels:  s.db.WithContext(ctx).Model(&models.Channel{}).Where("owner_id = ?", userID),
+		&usage.ActiveSessions: s.db.WithContext(ctx).Model(&models.Session{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()),
+		&usage.Tokens:         s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}).Where("user_id = ?", userID),
+	})
+	return usage, err
+}
+
+func (s gormAccounts) Stats(ctx context.Context) (SiteStats, error) {
+	now := time.Now()
+	var stats SiteStats
+	err := count(map[*int64]*gorm.DB{
+		&stats.Users:                s.db.WithContext(ctx).Model(&models.User{}),
+		&stats.Admins:               s.db.WithContext(ctx).Model(&models.User{}).Where("is_admin = ?", true),
+		&stats.SuspendedUsers:       s.db.WithContext(ctx).Model(&models.User{}).Where("suspended_at IS NOT NULL"),
+		&stats.LockedUsers:          s.db.WithContext(ctx).Model(&models.User{}).Where("locked_until > ?", now),
+		&stats.UnverifiedUsers:      s.db.WithContext(ctx).Model(&models.User{}).Where("email_verified_at IS NULL"),
+		&stats.Channels:             s.db.WithContext(ctx).Model(&models.Channel{}),
+		&stats.Memberships:          s.db.WithContext(ctx).Model(&models.ChannelMember{}),
+		&stats.ActiveSessions:       s.db.WithContext(ctx).Model(&models.Session{}).Where("expires_at > ?", now),
+		&stats.PersonalAccessTokens: s.db.WithContext(ctx).Model(&models.PersonalAccessToken{}),
+	})
+	return stats, err
+}
+
+// count runs each query's COUNT into its destination.
+func count(queries map[*int64]*gorm.DB) error {
+	for dst, query := range queries {
+		if err := query.Count(dst).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAccess deletes every session of userID but keep, and every personal
+// access token, returning their session IDs and keys.
+func revokeAccess(tx *gorm.DB, userID uint, keep string) ([]string, error) {
+	revoked, err := revokeSessions(tx, userID, keep)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := tokenKeys(tx, userID)
+	if err != nil || len(keys) == 0 {
+		return revoked, err
+	}
+	return append(revoked, keys...), tx.Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{}).Error
+}
+
+// revokeSessions deletes every session of userID but keep and returns their
+// IDs.
+func revokeSessions(tx *gorm.DB, userID uint, keep string) ([]string, error) {
+	var ids []string
+	if err := tx.Model(&models.Session{}).Where("user_id = ? AND id <> ?", userID, keep).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return ids, tx.Where("id IN ?", ids).Delete(&models.Session{}).Error
+}
+
+// tokenKeys returns the session keys of userID's personal access tokens.
+func tokenKeys(tx *gorm.DB, userID uint) ([]string, error) {
+	var tokens []models.PersonalAccessToken
+	if err := tx.Where("user_id = ?", userID).Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		keys = append(keys, token.SessionKey())
+	}
+	return keys, nil
+}
+
+// escapeLike makes s match literally inside a LIKE pattern. The escape
+// character is "!" because a backslash would need quoting differently in
+// each supported database.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+type gormLogins struct {
+	db *gorm.DB
+}
+
+func (s gormLogins) Failed(ctx context.Context, userID uint, at time.Time, window time.Duration) (int, error) {
+	var failures int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// GORM sets map columns in key order, so MySQL, which applies SET
+		// left to right, evaluates the CASE against the previous failure
+		// time.
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"failed_logins":        gorm.Expr("CASE WHEN last_failed_login_at < ? THEN 1 ELSE failed_logins + 1 END", at.Add(-window)),
+			"last_failed_login_at": at,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Pluck("failed_logins", &failures).Error
+	})
+	return failures, err
+}
+
+func (s gormLogins) Lock(ctx context.Context, userID uint, until time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"locked_until":  until,
+		"failed_logins": 0,
+	}).Error
+}
+
+func (s gormLogins) Succeeded(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_logins":        0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error
+}
+
+func (s gormLogins) AddUnlock(ctx context.Context, unlock *models.AccountUnlock) error {
+	return s.db.WithContext(ctx).Create(unlock).Error
+}
+
+func (s gormLogins) UnlockUser(ctx context.Context, tokenHash string) (uint, error) {
+	var unlock models.AccountUnlock
+	err := s.db.WithContext(ctx).Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&unlock).Error
+	return unlock.UserID, translate(err)
+}
+
+func (s gormLogins) Unlock(ctx context.Context, userID uint) error {
+	return translate(s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"failed_logins":        0,
+			"last_failed_login_at": nil,
+			"locked_until":         nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var n int64
+			if err := tx.Model(&models.User{}).Where("id = ?", userID).Count(&n).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrNotFound
+			}
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.AccountUnlock{}).Error
+	}))
+}
+
+func (s gormLogins) SetTOTPSecret(ctx context.Context, userID uint, secret string) error {
+	return s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error
+}
+
+func (s gormLogins) EnableTwoFactor(ctx context.Context, userID uint, step int64, codeHashes []string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+		codes := make([]models.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (s gormLogins) DisableTwoFactor(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+func (s gormLogins) UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error) {
+	// Conditional update so a code is accepted at most once, even when two
+	// requests race.
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s gormLogins) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/models"
+)
+
+func createUsers(t *testing.T, users Users, names ...string) []models.User {
+	t.Helper()
+	created := make([]models.User, 0, len(names))
+	for _, name := range names {
+		user := models.User{Username: name, Email: name + "@example.com", Password: "x"}
+		if err := users.Create(context.Background(), &user); err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, user)
+	}
+	return created
+}
+
+func TestGormAccountsLink(t *testing.T) {
+	ctx := context.Background()
+	stores := NewGorm(newTestDB(t))
+	bob := createUsers(t, stores.Users, "bob")[0]
+
+	if err := stores.Accounts.Link(ctx, &bob, &models.UserIdentity{Issuer: "https://idp", Subject: "bob-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if bob.EmailVerifiedAt != nil {
+		t.Fatal("linking marked the existing user's email verified")
+	}
+
+	alice := models.User{Username: "alice", Email: "alice@example.com", Password: "x"}
+	if err := stores.Accounts.Link(ctx, &alice, &models.UserIdentity{Issuer: "https://idp", Subject: "alice-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID == 0 {
+		t.Fatal("Link did not create the new user")
+	}
+
+	got, err := stores.Accounts.ByIdentity(ctx, "https://idp", "alice-1")
+	if err != nil || got.ID != alice.ID || got.Username != "alice" {
+		t.Fatalf("ByIdentity = %+v, %v", got, err)
+	}
+	if _, err := stores.Accounts.ByIdentity(ctx, "https://other", "alice-1"); err != ErrNotFound {
+		t.Fatalf("ByIdentity for another issuer = %v, want ErrNotFound", err)
+	}
+	if err := stores.Accounts.Link(ctx, &bob, &models.UserIdentity{Issuer: "https://idp", Subject: "alice-1"}); err != ErrConflict {
+		t.Fatalf("linking a taken identity = %v, want ErrConflict", err)
+	}
+}
+
+func TestGormAccountsDelete(t *testing.T) {
+	ctx := context.Background()
+	stores := NewGorm(newTestDB(t))
+	users := createUsers(t, stores.Users, "alice", "bob")
+	alice, bob := users[0], users[1]
+
+	owned := models.Channel{Name: "general", OwnerID: alice.ID}
+	if err := stores.Channels.Create(ctx, &owned); err != nil {
+		t.Fatal(err)
+	}
+	joined := models.Channel{Name: "random", OwnerID: bob.ID}
+	if err := stores.Channels.Create(ctx, &joined); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []struct{ channel, user uint }{{owned.ID, bob.ID}, {joined.ID, alice.ID}} {
+		if err := stores.Memberships.Add(ctx, m.channel, m.user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	if err := stores.Sessions.Create(ctx, &models.Session{ID: "s1", UserID: alice.ID, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	token := models.PersonalAccessToken{UserID: alice.ID, Name: "bot", Prefix: "pat_", TokenHash: "hash", Scopes: []string{"read"}}
+	if err := stores.Tokens.Create(ctx, &token); err != nil {
+		t.Fatal(err)
+	}
+
+	channelIDs, revoked, err := stores.Accounts.Delete(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channelIDs) != 1 || channelIDs[0] != owned.ID {
+		t.Fatalf("deleted channels = %v, want [%d]", channelIDs, owned.ID)
+	}
+	if len(revoked) != 2 || revoked[0] != "s1" || revoked[1] != token.SessionKey() {
+		t.Fatalf("revoked = %v, want the session and the token", revoked)
+	}
+
+	if _, err := stores.Users.ByID(ctx, alice.ID); err != ErrNotFound {
+		t.Fatalf("user after Delete: %v", err)
+	}
+	if _, err := stores.Channels.Get(ctx, owned.ID); err != ErrNotFound {
+		t.Fatalf("owned channel after Delete: %v", err)
+	}
+	members, err := stores.Memberships.Members(ctx, joined.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].ID != bob.ID {
+		t.Fatalf("members of the joined channel = %+v, want only bob", members)
+	}
+}
+
+func TestGormAccountsList(t *testing.T) {
+	ctx := context.Background()
+	stores := NewGorm(newTestDB(t))
+	users := createUsers(t, stores.Users, "a_b", "axb", "carol")
+
+	if _, err := stores.Accounts.Suspend(ctx, users[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter UserFilter
+		want   []string
+	}{
+		{"all", UserFilter{}, []string{"carol", "axb", "a_b"}},
+		{"literal underscore", UserFilter{Query: "a_b"}, []string{"a_b"}},
+		{"suspended", UserFilter{Suspended: true}, []string{"carol"}},
+		{"page", UserFilter{BeforeID: users[2].ID, Limit: 1}, []string{"axb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := stores.Accounts.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, user := range list {
+				got = append(got, user.Username)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	stats, err := stores.Accounts.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Users != 3 || stats.SuspendedUsers != 1 || stats.UnverifiedUsers != 3 {
+		t.Fatalf("Stats = %+v", stats)
+	}
+}
+
+func TestGormLoginsFailed(t *testing.T) {
+	ctx := context.Background()
+	stores := NewGorm(newTestDB(t))
+	bob := createUsers(t, stores.Users, "bob")[0]
+
+	start := time.Now().Add(-time.Hour)
+	for i, want := range []int{1, 2, 3} {
+		n, err := stores.Logins.Failed(ctx, bob.ID, start.Add(time.Duration(i)*time.Minute), 15*time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("failure %d counted as %d", want, n)
+		}
+	}
+
+	// Past the window the count starts again.
+	n, err := stores.Logins.Failed(ctx, bob.ID, start.Add(30*time.Minute), 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("failure after a quiet window counted as %d, want 1", n)
+	}
+
+	if err := stores.Logins.Unlock(ctx, bob.ID+100); err != ErrNotFound {
+		t.Fatalf("Unlock of a missing user = %v, want ErrNotFound", err)
+	}
+}
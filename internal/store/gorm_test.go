@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/db"
+	"webFianlBackend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB returns a migrated in-memory SQLite database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := db.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := conn.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestGormAuditFilter(t *testing.T) {
+	ctx := context.Background()
+	trail := NewGorm(newTestDB(t)).Audit
+
+	alice, bob, channel := uint(1), uint(2), uint(7)
+	start := time.Now().Add(-time.Hour)
+	for i, event := range []models.AuditEvent{
+		{Action: "login", ActorID: &alice},
+		{Action: "login", ActorID: &bob},
+		{Action: "channel.create", ActorID: &alice, ChannelID: &channel},
+		{Action: "admin.suspend", ActorID: &alice, TargetUserID: &bob},
+	} {
+		event.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := trail.Append(ctx, &event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []string
+	}{
+		{"all", AuditFilter{}, []string{"admin.suspend", "channel.create", "login", "login"}},
+		{"action", AuditFilter{Action: "login"}, []string{"login", "login"}},
+		{"actor", AuditFilter{ActorID: bob}, []string{"login"}},
+		{"target", AuditFilter{TargetUserID: bob}, []string{"admin.suspend"}},
+		{"channel", AuditFilter{ChannelID: channel}, []string{"channel.create"}},
+		{"window", AuditFilter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []string{"channel.create", "login"}},
+		{"page", AuditFilter{BeforeID: 4, Limit: 2}, []string{"channel.create", "login"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := trail.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, event := range events {
+				got = append(got, event.Action)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	n, err := trail.Count(ctx, AuditFilter{Action: "login", Since: start, BeforeID: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("Count = %d, want 2", n)
+	}
+}
+
+func TestGormSessionsAndTokens(t *testing.T) {
+	ctx := context.Background()
+	stores := NewGorm(newTestDB(t))
+
+	users := map[string]models.User{}
+	for _, name := range []string{"alice", "bob"} {
+		user := models.User{Username: name, Email: name + "@example.com", Password: "x"}
+		if err := stores.Users.Create(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+	alice, bob := users["alice"].ID, users["bob"].ID
+
+	now := time.Now()
+	for _, session := range []models.Session{
+		{ID: "a1", UserID: alice, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "a2", UserID: alice, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: "a3", UserID: alice, LastSeenAt: now, ExpiresAt: now.Add(-time.Minute)},
+		{ID: "b1", UserID: bob, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+	} {
+		if err := stores.Sessions.Create(ctx, &session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := stores.Sessions.Active(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("Active = %d sessions, want 2", len(active))
+	}
+	if err := stores.Sessions.Delete(ctx, alice, "b1"); err != ErrNotFound {
+		t.Fatalf("deleting another user's session = %v, want ErrNotFound", err)
+	}
+	removed, err := stores.Sessions.DeleteOthers(ctx, alice, "a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Fatalf("DeleteOthers removed %v, want a2 and a3", removed)
+	}
+	if err := stores.Sessions.Delete(ctx, bob, "b1"); err != nil {
+		t.Fatalf("bob's session was touched: %v", err)
+	}
+
+	token := models.PersonalAccessToken{UserID: alice, Name: "bot", Prefix: "pat_", TokenHash: "hash", Scopes: []string{"read"}}
+	if err := stores.Tokens.Create(ctx, &token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stores.Tokens.Delete(ctx, bob, token.ID); err != ErrNotFound {
+		t.Fatalf("deleting another user's token = %v, want ErrNotFound", err)
+	}
+	deleted, err := stores.Tokens.Delete(ctx, alice, token.ID)
+	if err != nil || deleted.Name != "bot" {
+		t.Fatalf("Delete = %+v, %v", deleted, err)
+	}
+	if tokens, err := stores.Tokens.List(ctx, alice); err != nil || len(tokens) != 0 {
+		t.Fatalf("List after Delete = %v, %v", tokens, err)
+	}
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"webFianlBackend/internal/models"
+	"webFianlBackend/internal/utils"
+)
+
+// Memory keeps users, channels and memberships in maps. It is meant for
+// tests of package service and behaves like the GORM stores, including
+// ErrNotFound and ErrConflict.
+type Memory struct {
+	mu       sync.Mutex
+	lastID   uint
+	users    map[uint]models.User
+	channels map[uint]models.Channel
+	members  map[membership]bool
+}
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory {
+	return &Memory{
+		users:    make(map[uint]models.User),
+		channels: make(map[uint]models.Channel),
+		members:  make(map[membership]bool),
+	}
+}
+
+// Store returns the stores backed by m; the others are left nil.
+func (m *Memory) Store() Store {
+	return Store{
+		Users:       memoryUsers{m},
+		Channels:    memoryChannels{m},
+		Memberships: memoryMemberships{m},
+	}
+}
+
+// membership is the key of Memory.members.
+type membership struct {
+	channelID, userID uint
+}
+
+func (m *Memory) nextID() uint {
+	m.lastID++
+	return m.lastID
+}
+
+type memoryUsers struct {
+	m *Memory
+}
+
+func (s memoryUsers) ByID(ctx context.Context, id uint) (models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	user, ok := s.m.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s memoryUsers) ByUsername(ctx context.Context, username string) (models.User, error) {
+	key := utils.IdentityKey(username)
+	return s.find(func(user models.User) bool { return user.UsernameKey == key })
+}
+
+func (s memoryUsers) ByEmail(ctx context.Context, email string) (models.User, error) {
+	key := utils.IdentityKey(email)
+	return s.find(func(user models.User) bool { return user.EmailKey == key })
+}
+
+func (s memoryUsers) find(match func(models.User) bool) (models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, user := range s.m.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (s memoryUsers) Names(ctx context.Context, ids []uint) ([]models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	users := []models.User{}
+	for _, id := range ids {
+		if user, ok := s.m.users[id]; ok {
+			users = append(users, models.User{ID: user.ID, Username: user.Username})
+		}
+	}
+	sortByUsername(users)
+	return users, nil
+}
+
+func (s memoryUsers) Create(ctx context.Context, user *models.User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	user.BeforeSave(nil)
+	for _, other := range s.m.users {
+		if other.UsernameKey == user.UsernameKey || other.EmailKey == user.EmailKey {
+			return ErrConflict
+		}
+	}
+	user.ID = s.m.nextID()
+	user.CreatedAt = time.Now()
+	s.m.users[user.ID] = *user
+	return nil
+}
+
+type memoryChannels struct {
+	m *Memory
+}
+
+func (s memoryChannels) Get(ctx context.Context, id uint) (models.Channel, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	channel, ok := s.m.channels[id]
+	if !ok {
+		return models.Channel{}, ErrNotFound
+	}
+	return s.withOwner(channel), nil
+}
+
+func (s memoryChannels) Find(ctx context.Context, ownerID uint, name string) (models.Channel, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, channel := range s.m.channels {
+		if channel.OwnerID == ownerID && channel.Name == name {
+			return s.withOwner(channel), nil
+		}
+	}
+	return models.Channel{}, ErrNotFound
+}
+
+func (s memoryChannels) Owned(ctx context.Context, userID uint) ([]models.Channel, error) {
+	return s.filter(func(channel models.Channel) bool {
+		return channel.OwnerID == userID
+	}), nil
+}
+
+func (s memoryChannels) Joined(ctx context.Context, userID uint) ([]models.Channel, error) {
+	return s.filter(func(channel models.Channel) bool {
+		return channel.OwnerID != userID && s.m.members[membership{channel.ID, userID}]
+	}), nil
+}
+
+func (s memoryChannels) Create(ctx context.Context, channel *models.Channel) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, other := range s.m.channels {
+		if other.OwnerID == channel.OwnerID && other.Name == channel.Name {
+			return ErrConflict
+		}
+	}
+	channel.ID = s.m.nextID()
+	channel.CreatedAt = time.Now()
+	s.m.channels[channel.ID] = *channel
+	s.m.members[membership{channel.ID, channel.OwnerID}] = true
+	return nil
+}
+
+func (s memoryChannels) Delete(ctx context.Context, id uint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for member := range s.m.members {
+		if member.channelID == id {
+			delete(s.m.members, member)
+		}
+	}
+	delete(s.m.channels, id)
+	return nil
+}
+
+// filter returns the matching channels with their owners, in ID order.
+func (s memoryChannels) filter(match func(models.Channel) bool) []models.Channel {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var channels []models.Channel
+	for _, channel := range s.m.channels {
+		if match(channel) {
+			channels = append(channels, s.withOwner(channel))
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].ID < channels[j].ID })
+	return channels
+}
+
+func (s memoryChannels) withOwner(channel models.Channel) models.Channel {
+	channel.Owner = s.m.users[channel.OwnerID]
+	return channel
+}
+
+type memoryMemberships struct {
+	m *Memory
+}
+
+func (s memoryMemberships) Add(ctx context.Context, channelID, userID uint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	s.m.members[membership{channelID, userID}] = true
+	return nil
+}
+
+func (s memoryMemberships) IsMember(ctx context.Context, channelID, userID uint) (bool, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return s.m.members[membership{channelID, userID}], nil
+}
+
+func (s memoryMemberships) Members(ctx context.Context, channelID uint) ([]models.User, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	var members []models.User
+	for member := range s.m.members {
+		if member.channelID != channelID {
+			continue
+		}
+		if user, ok := s.m.users[member.userID]; ok {
+			members = append(members, models.User{ID: user.ID, Username: user.Username, Email: user.Email, CreatedAt: user.CreatedAt})
+		}
+	}
+	sortByUsername(members)
+	return members, nil
+}
+
+func sortByUsername(users []models.User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+}
@@ -0,0 +1,223 @@
+// Package store defines the storage interfaces for users and their
+// accounts, channels, channel memberships, sessions, tokens and the audit
+// trail, and implements them on GORM. Business rules live in
+// package service; the stores only read and write.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"webFianlBackend/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a unique key.
+	ErrConflict = errors.New("conflict")
+)
+
+type Users interface {
+	ByID(ctx context.Context, id uint) (models.User, error)
+	// ByUsername finds a user by the normalized form of username.
+	ByUsername(ctx context.Context, username string) (models.User, error)
+	// ByEmail finds a user by the normalized form of email.
+	ByEmail(ctx context.Context, email string) (models.User, error)
+	// Names returns the ID and username of the given users, ordered by
+	// username. Unknown IDs are skipped.
+	Names(ctx context.Context, ids []uint) ([]models.User, error)
+	// Create inserts user; a taken username or email is ErrConflict.
+	Create(ctx context.Context, user *models.User) error
+}
+
+type Channels interface {
+	// Get returns a channel with its owner.
+	Get(ctx context.Context, id uint) (models.Channel, error)
+	// Find returns the channel called name owned by ownerID, with its owner.
+	Find(ctx context.Context, ownerID uint, name string) (models.Channel, error)
+	// Owned lists the channels owned by userID.
+	Owned(ctx context.Context, userID uint) ([]models.Channel, error)
+	// Joined lists the channels userID is a member of but does not own.
+	Joined(ctx context.Context, userID uint) ([]models.Channel, error)
+	// Create inserts channel and makes its owner a member.
+	Create(ctx context.Context, channel *models.Channel) error
+	// Delete removes a channel together with its memberships.
+	Delete(ctx context.Context, id uint) error
+}
+
+type Memberships interface {
+	// Add makes userID a member of channelID; it is a no-op for members.
+	Add(ctx context.Context, channelID, userID uint) error
+	IsMember(ctx context.Context, channelID, userID uint) (bool, error)
+	// Members returns the public fields of a channel's members, ordered by
+	// username.
+	Members(ctx context.Context, channelID uint) ([]models.User, error)
+}
+
+// UserFilter selects users for the admin listing. Zero fields match
+// everything.
+type UserFilter struct {
+	// Query matches part of the normalized username or email.
+	Query     string
+	Suspended bool
+	Locked    bool
+	Admin     bool
+	BeforeID  uint
+	Limit     int
+}
+
+// UserUsage counts what a user holds.
+type UserUsage struct {
+	OwnedChannels  int64
+	ActiveSessions int64
+	Tokens         int64
+}
+
+// SiteStats counts the server's records.
+type SiteStats struct {
+	Users                int64
+	Admins               int64
+	SuspendedUsers       int64
+	LockedUsers          int64
+	UnverifiedUsers      int64
+	Channels             int64
+	Memberships          int64
+	ActiveSessions       int64
+	PersonalAccessTokens int64
+}
+
+// Accounts changes accounts as a whole. Every method that revokes access
+// returns the session IDs and token session keys it revoked, so their
+// connections can be closed.
+type Accounts interface {
+	// ByIdentity finds the user linked to an OpenID Connect identity.
+	ByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// Link attaches identity to user, creating user first when its ID is
+	// zero. It does not change an existing user.
+	Link(ctx context.Context, user *models.User, identity *models.UserIdentity) error
+	// UpdateProfile saves user. With signOut it also bumps the token
+	// version and revokes every session but keep and all personal access
+	// tokens.
+	UpdateProfile(ctx context.Context, user *models.User, signOut bool, keep string) ([]string, error)
+	// Delete removes a user with everything they own, and returns the IDs
+	// of their deleted channels.
+	Delete(ctx context.Context, userID uint) (channelIDs []uint, revoked []string, err error)
+	// Suspend marks a user suspended and revokes their sessions. Their
+	// personal access tokens are kept but returned, as Auth rejects them
+	// while the suspension lasts.
+	Suspend(ctx context.Context, userID uint) ([]string, error)
+	Unsuspend(ctx context.Context, userID uint) error
+
+	// AddVerification stores a pending email verification, replacing any
+	// earlier one of the user.
+	AddVerification(ctx context.Context, verification *models.EmailVerification) error
+	// VerifyEmail consumes an unexpired verification token. It is
+	// ErrNotFound when the token is unknown or the address has changed
+	// since it was sent.
+	VerifyEmail(ctx context.Context, tokenHash string) (models.User, error)
+
+	AddPasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	// PasswordResetUser returns the user of an unused, unexpired reset
+	// token.
+	PasswordResetUser(ctx context.Context, tokenHash string) (models.User, error)
+	// ResetPassword consumes a reset token and sets passwordHash. It clears
+	// any lockout, treats the email as verified, and signs the user out
+	// everywhere, personal access tokens included.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (models.User, []string, error)
+
+	// List returns matching users, newest first.
+	List(ctx context.Context, filter UserFilter) ([]models.User, error)
+	Usage(ctx context.Context, userID uint) (UserUsage, error)
+	Stats(ctx context.Context) (SiteStats, error)
+}
+
+// Logins keeps the per-account state of logging in: failure throttling,
+// lockouts and two-factor authentication.
+type Logins interface {
+	// Failed counts a failed login at at and returns the failures so far.
+	// The count restarts when the previous failure is older than window.
+	Failed(ctx context.Context, userID uint, at time.Time, window time.Duration) (int, error)
+	// Lock locks the account until until and restarts the failure count.
+	Lock(ctx context.Context, userID uint, until time.Time) error
+	// Succeeded clears the failure count and any lockout.
+	Succeeded(ctx context.Context, userID uint) error
+	AddUnlock(ctx context.Context, unlock *models.AccountUnlock) error
+	// UnlockUser returns the user ID of an unexpired unlock token.
+	UnlockUser(ctx context.Context, tokenHash string) (uint, error)
+	// Unlock clears a lockout along with its pending unlock tokens.
+	Unlock(ctx context.Context, userID uint) error
+
+	// SetTOTPSecret starts enrollment with a new secret.
+	SetTOTPSecret(ctx context.Context, userID uint, secret string) error
+	// EnableTwoFactor turns two-factor on, marking step as used, and
+	// replaces the recovery codes with codeHashes.
+	EnableTwoFactor(ctx context.Context, userID uint, step int64, codeHashes []string) error
+	// DisableTwoFactor turns two-factor off and drops the secret and
+	// recovery codes.
+	DisableTwoFactor(ctx context.Context, userID uint) error
+	// UseTOTPStep records step as used. It reports false when step, or a
+	// later one, was used before.
+	UseTOTPStep(ctx context.Context, userID uint, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code as used. It reports
+	// false when there is none.
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (bool, error)
+}
+
+// Sessions stores server-side login sessions.
+type Sessions interface {
+	Create(ctx context.Context, session *models.Session) error
+	// Active lists the unexpired sessions of userID, most recently used
+	// first.
+	Active(ctx context.Context, userID uint) ([]models.Session, error)
+	// Delete removes session id of userID.
+	Delete(ctx context.Context, userID uint, id string) error
+	// DeleteOthers removes every session of userID except keep and returns
+	// the removed IDs.
+	DeleteOthers(ctx context.Context, userID uint, keep string) ([]string, error)
+}
+
+// Tokens stores personal access tokens.
+type Tokens interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	// List returns the tokens of userID, newest first.
+	List(ctx context.Context, userID uint) ([]models.PersonalAccessToken, error)
+	// Delete removes token id of userID and returns it.
+	Delete(ctx context.Context, userID, id uint) (models.PersonalAccessToken, error)
+}
+
+// AuditFilter selects audit events. Zero fields match everything.
+type AuditFilter struct {
+	Action       string
+	ActorID      uint
+	TargetUserID uint
+	ChannelID    uint
+	// Since is inclusive, Until exclusive.
+	Since time.Time
+	Until time.Time
+	// BeforeID and Limit page through List; Count ignores them.
+	BeforeID uint
+	Limit    int
+}
+
+type Audit interface {
+	// Append adds event to the trail.
+	Append(ctx context.Context, event *models.AuditEvent) error
+	// List returns the matching events, newest first.
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error)
+	// Count returns the number of matching events.
+	Count(ctx context.Context, filter AuditFilter) (int64, error)
+}
+
+// Store groups the stores a service works with.
+type Store struct {
+	Users       Users
+	Channels    Channels
+	Memberships Memberships
+	Accounts    Accounts
+	Logins      Logins
+	Sessions    Sessions
+	Tokens      Tokens
+	Audit       Audit
+}
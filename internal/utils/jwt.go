@@ -6,33 +6,54 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	TwoFactorPendingTTL = 5 * time.Minute
+
+	// PurposeTwoFactor marks a token that only proves the password step of a
+	// two-factor login; it is not accepted as a session token.
+	PurposeTwoFactor = "2fa_pending"
+)
+
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
+	Version   uint   `json:"ver"`
+	Purpose   string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, username, secret string) (string, error) {
+func GenerateToken(userID uint, username, sessionID string, version uint, ttl time.Duration, keys *KeySet) (string, error) {
+	claims := Claims{
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
+		Version:   version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.sign(claims)
+}
+
+func GenerateTwoFactorToken(userID uint, version uint, keys *KeySet) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
+		UserID:  userID,
+		Version: version,
+		Purpose: PurposeTwoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TwoFactorPendingTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
 
-func ParseToken(tokenStr, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, jwt.ErrTokenSignatureInvalid
-		}
-		return []byte(secret), nil
-	})
+func ParseToken(tokenStr string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keys.keyFunc)
 	if err != nil {
 		return nil, err
 	}
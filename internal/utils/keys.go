@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet holds the key tokens are signed with and every key tokens are still
+// accepted from. Keeping a retired key in the verification set lets tokens it
+// signed live out their TTL after a rotation.
+type KeySet struct {
+	signing    jwtKey
+	verifying  map[string]jwtKey
+	publicKeys []jwtKey
+}
+
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// sign is the private key or HMAC secret; verify the public key or secret.
+	sign   interface{}
+	verify interface{}
+}
+
+// NewHMACKeySet signs and verifies with a single HS256 shared secret.
+func NewHMACKeySet(secret string) *KeySet {
+	key := jwtKey{method: jwt.SigningMethodHS256, sign: []byte(secret), verify: []byte(secret)}
+	return &KeySet{
+		signing:   key,
+		verifying: map[string]jwtKey{"": key},
+	}
+}
+
+// KeyConfig describes how to build an asymmetric KeySet.
+type KeyConfig struct {
+	// Algorithm is RS256 or EdDSA.
+	Algorithm string
+	// PrivateKeyFile is the PEM (PKCS#8, or PKCS#1 for RSA) signing key.
+	PrivateKeyFile string
+	// KeyID overrides the kid of the signing key. Defaults to the RFC 7638
+	// thumbprint.
+	KeyID string
+	// VerifyKeyFiles are additional PEM public (or private) keys still
+	// accepted, as "path" or "kid=path".
+	VerifyKeyFiles []string
+	// LegacySecret, when set, keeps accepting HS256 tokens without a kid,
+	// for switching away from a shared secret without logging users out.
+	LegacySecret string
+}
+
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	method := jwt.GetSigningMethod(cfg.Algorithm)
+	switch method {
+	case jwt.SigningMethodRS256, jwt.SigningMethodEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	signing, err := loadKeyFile(cfg.PrivateKeyFile, cfg.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("signing key: %w", err)
+	}
+	if signing.sign == nil {
+		return nil, errors.New("signing key: file holds no private key")
+	}
+	if signing.method != method {
+		return nil, fmt.Errorf("signing key: key type does not match %s", cfg.Algorithm)
+	}
+
+	ks := &KeySet{
+		signing:   signing,
+		verifying: map[string]jwtKey{signing.kid: signing},
+	}
+	ks.publicKeys = append(ks.publicKeys, signing)
+
+	for _, entry := range cfg.VerifyKeyFiles {
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i > 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		key, err := loadKeyFile(path, kid)
+		if err != nil {
+			return nil, fmt.Errorf("verify key %s: %w", path, err)
+		}
+		if _, exists := ks.verifying[key.kid]; exists {
+			continue
+		}
+		key.sign = nil
+		ks.verifying[key.kid] = key
+		ks.publicKeys = append(ks.publicKeys, key)
+	}
+
+	if cfg.LegacySecret != "" {
+		legacy := NewHMACKeySet(cfg.LegacySecret).signing
+		legacy.sign = nil
+		ks.verifying[""] = legacy
+	}
+
+	return ks, nil
+}
+
+func loadKeyFile(path, kid string) (jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return jwtKey{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return jwtKey{}, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return jwtKey{}, err
+	}
+
+	var key jwtKey
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key = jwtKey{method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}
+	case *rsa.PublicKey:
+		key = jwtKey{method: jwt.SigningMethodRS256, verify: k}
+	case ed25519.PrivateKey:
+		key = jwtKey{method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}
+	case ed25519.PublicKey:
+		key = jwtKey{method: jwt.SigningMethodEdDSA, verify: k}
+	default:
+		return jwtKey{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	key.kid = kid
+	if key.kid == "" {
+		key.kid = thumbprint(key.verify)
+	}
+	return key, nil
+}
+
+func (ks *KeySet) sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.kid != "" {
+		token.Header["kid"] = ks.signing.kid
+	}
+	return token.SignedString(ks.signing.sign)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.verifying[kid]
+	if !ok || token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	return key.verify, nil
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public verification keys. HMAC secrets are never published,
+// so a shared-secret KeySet yields an empty set.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.publicKeys {
+		jwk := publicJWK(key.verify)
+		jwk.Kid = key.kid
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func publicJWK(pub interface{}) JWK {
+	enc := base64.RawURLEncoding
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(k.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: enc.EncodeToString(k)}
+	}
+	return JWK{}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, used as the default kid.
+func thumbprint(pub crypto.PublicKey) string {
+	jwk := publicJWK(pub)
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var identityFolder = cases.Fold()
+
+// NormalizeIdentity returns the form a username or email is stored in:
+// NFKC-normalized with surrounding whitespace removed, case preserved.
+func NormalizeIdentity(s string) string {
+	return norm.NFKC.String(strings.TrimSpace(s))
+}
+
+// IdentityKey returns the comparison key for a username or email, so that
+// values differing only in case or Unicode form collide.
+func IdentityKey(s string) string {
+	return norm.NFKC.String(identityFolder.String(NormalizeIdentity(s)))
+}
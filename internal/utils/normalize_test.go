@@ -0,0 +1,62 @@
+package utils
+
+import "testing"
+
+func TestIdentityKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"  Bob ", "bob"},
+		{"ＡＬＩＣＥ", "alice"},                     // fullwidth
+		{"bob@ＥＸＡＭＰＬＥ.com", "bob@example.com"}, // fullwidth in an email
+		{"ﬁle", "file"},                        // ligature
+		{"ﬀ", "ff"},
+		{"ǅ", "dž"},           // titlecase digraph
+		{"Straße", "strasse"}, // ß folds to ss
+		{"ẞ", "ss"},
+		{"\u00c5", "\u00e5"},  // composed Å
+		{"A\u030a", "\u00e5"}, // decomposed Å
+		{"\u212b", "\u00e5"},  // angstrom sign
+		{"\u212a", "k"},       // kelvin sign
+		{"①", "1"},
+		{"ISTANBUL", "istanbul"},
+		// Full case folding is not Turkish-aware: dotted capital I keeps
+		// its dot and dotless i stays distinct.
+		{"\u0130stanbul", "i\u0307stanbul"},
+		{"\u0131stanbul", "\u0131stanbul"},
+	}
+	for _, tt := range tests {
+		if got := IdentityKey(tt.in); got != tt.want {
+			t.Errorf("IdentityKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIdentityKeyCollisions(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		collide bool
+	}{
+		{"admin", "ＡＤＭＩＮ", true},
+		{"office", "oﬃce", true},
+		{"strasse", "Straße", true},
+		{"STRASSE", "straße", true},
+		{"istanbul", "ISTANBUL", true},
+		{"istanbul", "ıstanbul", false},
+		{"istanbul", "İstanbul", false},
+		{"ıstanbul", "İstanbul", false},
+		{"alice", "alice2", false},
+	}
+	for _, tt := range tests {
+		if got := IdentityKey(tt.a) == IdentityKey(tt.b); got != tt.collide {
+			t.Errorf("%q and %q collide = %v, want %v", tt.a, tt.b, got, tt.collide)
+		}
+	}
+}
+
+func TestNormalizeIdentityKeepsCase(t *testing.T) {
+	if got := NormalizeIdentity(" Ｓtraße "); got != "Straße" {
+		t.Errorf("NormalizeIdentity = %q, want %q", got, "Straße")
+	}
+}
@@ -13,3 +13,15 @@ func HashPassword(raw string) (string, error) {
 func CheckPassword(hash, raw string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(raw)) == nil
 }
+
+// dummyPasswordHash is a bcrypt hash, at HashPassword's cost, of a password
+// nobody uses.
+const dummyPasswordHash = "$2a$10$gzr9qMLO1qcsYdHrGVSAw.ujD3OUnNL0f61mJ8Qa5n.Hz28Tgrk0y"
+
+// CheckNoPassword spends as long as CheckPassword and always fails. Logins
+// for unknown accounts call it so that response times do not reveal which
+// accounts exist.
+func CheckNoPassword(raw string) bool {
+	CheckPassword(dummyPasswordHash, raw)
+	return false
+}
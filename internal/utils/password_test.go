@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckNoPasswordMatchesHashCost(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil || got != want {
+		t.Fatalf("dummy hash cost = %d, %v; want %d like HashPassword", got, err, want)
+	}
+
+	if CheckNoPassword("correct horse") || CheckNoPassword("") {
+		t.Fatal("CheckNoPassword accepted a password")
+	}
+	if !CheckPassword(hash, "correct horse") || CheckPassword(hash, "wrong") {
+		t.Fatal("CheckPassword disagrees with HashPassword")
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of RFC 6238 Appendix B.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8-digit codes; ours are their last 6 digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+		if step, ok := ValidateTOTP(rfc6238Secret, tt.want, time.Unix(tt.unix, 0)); !ok || step != tt.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v", tt.want, tt.unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	issued := time.Unix(1111111111, 0)
+	code, err := TOTPCode(rfc6238Secret, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := issued.Unix() / totpPeriod
+
+	for _, offset := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+		got, ok := ValidateTOTP(rfc6238Secret, code, issued.Add(offset))
+		if !ok || got != step {
+			t.Errorf("code checked %v after issue = %d, %v; want step %d", offset, got, ok, step)
+		}
+	}
+	for _, offset := range []time.Duration{-2 * totpPeriod * time.Second, 2 * totpPeriod * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, issued.Add(offset)); ok {
+			t.Errorf("code checked %v after issue was accepted", offset)
+		}
+	}
+
+	spaced := code[:3] + " " + code[3:]
+	if _, ok := ValidateTOTP(rfc6238Secret, spaced, issued); !ok {
+		t.Errorf("code with a space %q was rejected", spaced)
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, bad, issued); ok {
+			t.Errorf("ValidateTOTP(%q) accepted", bad)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", code, issued); ok {
+		t.Error("ValidateTOTP accepted a malformed secret")
+	}
+}
@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"webFianlBackend/internal/utils"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// FieldErrors maps a payload field name to a human-readable problem.
+type FieldErrors map[string]string
+
+func (fe FieldErrors) Error() string {
+	fields := make([]string, 0, len(fe))
+	for field := range fe {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, field+": "+fe[field])
+	}
+	return strings.Join(parts, "; ")
+}
+
+type Config struct {
+	PasswordMinLength int
+	PasswordMaxLength int
+	// BreachedPasswordsFile lists additional known-breached passwords, one
+	// per line, checked on top of the built-in list.
+	BreachedPasswordsFile string
+	UsernameMinLength     int
+	UsernameMaxLength     int
+	UsernamePattern       string
+	ReservedUsernames     []string
+}
+
+// Policy validates user-supplied identity fields.
+type Policy struct {
+	cfg             Config
+	usernamePattern *regexp.Regexp
+	// reserved is keyed by utils.IdentityKey, so lookalikes of a reserved
+	// name are reserved too.
+	reserved map[string]bool
+	breached map[string]bool
+}
+
+func NewPolicy(cfg Config) (*Policy, error) {
+	pattern, err := regexp.Compile(cfg.UsernamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("username pattern: %w", err)
+	}
+	if cfg.PasswordMinLength < 1 || cfg.PasswordMaxLength < cfg.PasswordMinLength {
+		return nil, fmt.Errorf("password length bounds %d..%d are invalid", cfg.PasswordMinLength, cfg.PasswordMaxLength)
+	}
+	// bcrypt ignores everything past 72 bytes.
+	if cfg.PasswordMaxLength > 72 {
+		return nil, fmt.Errorf("password max length %d exceeds bcrypt's 72 byte limit", cfg.PasswordMaxLength)
+	}
+	if cfg.UsernameMinLength < 1 || cfg.UsernameMaxLength < cfg.UsernameMinLength || cfg.UsernameMaxLength > 64 {
+		return nil, fmt.Errorf("username length bounds %d..%d are invalid", cfg.UsernameMinLength, cfg.UsernameMaxLength)
+	}
+
+	p := &Policy{
+		cfg:             cfg,
+		usernamePattern: pattern,
+		reserved:        make(map[string]bool),
+		breached:        make(map[string]bool),
+	}
+	for _, name := range cfg.ReservedUsernames {
+		p.reserved[utils.IdentityKey(name)] = true
+	}
+
+	if err := p.addBreached(strings.NewReader(commonPasswords)); err != nil {
+		return nil, fmt.Errorf("built-in breached passwords: %w", err)
+	}
+	if cfg.BreachedPasswordsFile != "" {
+		f, err := os.Open(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("breached passwords: %w", err)
+		}
+		defer f.Close()
+		if err := p.addBreached(f); err != nil {
+			return nil, fmt.Errorf("breached passwords: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Policy) addBreached(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			p.breached[strings.ToLower(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Username returns a problem description, or "" when name is acceptable.
+func (p *Policy) Username(name string) string {
+	n := utf8.RuneCountInString(name)
+	switch {
+	case n < p.cfg.UsernameMinLength:
+		return fmt.Sprintf("must be at least %d characters", p.cfg.UsernameMinLength)
+	case n > p.cfg.UsernameMaxLength:
+		return fmt.Sprintf("must be at most %d characters", p.cfg.UsernameMaxLength)
+	case strings.Contains(name, "@"):
+		return "must not contain @"
+	case !p.usernamePattern.MatchString(name):
+		return "contains characters that are not allowed"
+	case p.reserved[utils.IdentityKey(name)]:
+		return "is reserved"
+	}
+	return ""
+}
+
+// Email returns a problem description, or "" when email is acceptable.
+func (p *Policy) Email(email string) string {
+	if len(email) > 255 {
+		return "must be at most 255 characters"
+	}
+	addr, err := mail.ParseAddress(email)
+	// Reject display-name forms such as "Bob <bob@example.com>".
+	if err != nil || addr.Address != email {
+		return "is not a valid email address"
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "is not a valid email address"
+	}
+	return ""
+}
+
+// Password returns a problem description, or "" when password is
+// acceptable. identity holds the username and email, which the password
+// must not equal.
+func (p *Policy) Password(password string, identity ...string) string {
+	n := utf8.RuneCountInString(password)
+	switch {
+	case n < p.cfg.PasswordMinLength:
+		return fmt.Sprintf("must be at least %d characters", p.cfg.PasswordMinLength)
+	case len(password) > p.cfg.PasswordMaxLength:
+		return fmt.Sprintf("must be at most %d bytes", p.cfg.PasswordMaxLength)
+	case p.breached[strings.ToLower(password)]:
+		return "appears in a list of breached passwords"
+	}
+	for _, value := range identity {
+		if value != "" && strings.EqualFold(password, value) {
+			return "must not match your name or email"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package validation
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestPolicy returns a policy with the server's default settings.
+func newTestPolicy(t *testing.T, breachedFile string) *Policy {
+	t.Helper()
+	p, err := NewPolicy(Config{
+		PasswordMinLength:     8,
+		PasswordMaxLength:     72,
+		BreachedPasswordsFile: breachedFile,
+		UsernameMinLength:     3,
+		UsernameMaxLength:     32,
+		UsernamePattern:       `^[A-Za-z0-9_.-]+$`,
+		ReservedUsernames:     []string{"admin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUsernameReservedLookalikes(t *testing.T) {
+	p, err := NewPolicy(Config{
+		PasswordMinLength: 8,
+		PasswordMaxLength: 72,
+		UsernameMinLength: 1,
+		UsernameMaxLength: 64,
+		UsernamePattern:   `^\S+$`,
+		ReservedUsernames: []string{"Admin", "support"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"admin", "ADMIN", "Ａｄｍｉｎ", "SUPPORT", "ｓｕｐｐｏｒｔ"} {
+		if got := p.Username(name); got != "is reserved" {
+			t.Errorf("Username(%q) = %q, want is reserved", name, got)
+		}
+	}
+	for _, name := range []string{"admins", "supporter", "bob"} {
+		if got := p.Username(name); got != "" {
+			t.Errorf("Username(%q) = %q, want accepted", name, got)
+		}
+	}
+}
+
+func TestUsername(t *testing.T) {
+	p := newTestPolicy(t, "")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"bob", ""},
+		{"bob_smith.2-x", ""},
+		{strings.Repeat("b", 32), ""},
+		{"bo", "must be at least 3 characters"},
+		{strings.Repeat("b", 33), "must be at most 32 characters"},
+		{"bob@example.com", "must not contain @"},
+		{"@bob", "must not contain @"},
+		{"bob smith", "contains characters that are not allowed"},
+		{"bob!", "contains characters that are not allowed"},
+		{"böb", "contains characters that are not allowed"},
+		{"Admin", "is reserved"},
+	}
+	for _, tt := range tests {
+		if got := p.Username(tt.name); got != tt.want {
+			t.Errorf("Username(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	p := newTestPolicy(t, "")
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"bob@example.com", ""},
+		{"bob.smith+chat@mail.example.co.uk", ""},
+		{"bob", "is not a valid email address"},
+		{"bob@", "is not a valid email address"},
+		{"@example.com", "is not a valid email address"},
+		{"bob@localhost", "is not a valid email address"},
+		{"bob@.example.com", "is not a valid email address"},
+		{"bob@example.com.", "is not a valid email address"},
+		{"Bob <bob@example.com>", "is not a valid email address"},
+		{"bob@example.com, eve@example.com", "is not a valid email address"},
+		{strings.Repeat("b", 250) + "@example.com", "must be at most 255 characters"},
+	}
+	for _, tt := range tests {
+		if got := p.Email(tt.email); got != tt.want {
+			t.Errorf("Email(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	breached := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(breached, []byte("correct horse battery\n\n  Tr0ub4dor&3  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPolicy(t, breached)
+
+	tests := []struct {
+		name     string
+		password string
+		identity []string
+		want     string
+	}{
+		{"acceptable", "a good password", nil, ""},
+		{"minimum length", "x7#kq9!z", nil, ""},
+		{"too short", "x7#kq9!", nil, "must be at least 8 characters"},
+		// The minimum counts characters, the maximum bcrypt's bytes.
+		{"short in bytes", "ééééééé", nil, "must be at least 8 characters"},
+		{"maximum length", strings.Repeat("x", 72), nil, ""},
+		{"too long", strings.Repeat("x", 73), nil, "must be at most 72 bytes"},
+		{"too long in bytes", strings.Repeat("é", 37), nil, "must be at most 72 bytes"},
+		{"built-in list", "password", nil, "appears in a list of breached passwords"},
+		{"built-in list any case", "PassWord", nil, "appears in a list of breached passwords"},
+		{"configured file", "Correct Horse Battery", nil, "appears in a list of breached passwords"},
+		{"configured file trimmed", "tr0ub4dor&3", nil, "appears in a list of breached passwords"},
+		{"matches username", "Bob-Smith-1", []string{"bob-smith-1", "bob@example.com"}, "must not match your name or email"},
+		{"matches email", "BOB@example.com", []string{"bob", "bob@example.com"}, "must not match your name or email"},
+		{"empty identity ignored", "a good password", []string{"", ""}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Password(tt.password, tt.identity...); got != tt.want {
+				t.Errorf("Password(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyRejectsBadConfig(t *testing.T) {
+	valid := Config{PasswordMinLength: 8, PasswordMaxLength: 72, UsernameMinLength: 3, UsernameMaxLength: 32, UsernamePattern: `^\w+$`}
+	tests := []struct {
+		name   string
+		change func(*Config)
+	}{
+		{"pattern", func(c *Config) { c.UsernamePattern = "[" }},
+		{"password bounds", func(c *Config) { c.PasswordMinLength = 80 }},
+		{"bcrypt limit", func(c *Config) { c.PasswordMaxLength = 100 }},
+		{"username bounds", func(c *Config) { c.UsernameMinLength = 0 }},
+		{"username max", func(c *Config) { c.UsernameMaxLength = 65 }},
+		{"missing breached file", func(c *Config) { c.BreachedPasswordsFile = filepath.Join(t.TempDir(), "missing") }},
+	}
+	for _, tt := range tests {
+		cfg := valid
+		tt.change(&cfg)
+		if _, err := NewPolicy(cfg); err == nil {
+			t.Errorf("%s: NewPolicy accepted %+v", tt.name, cfg)
+		}
+	}
+	if _, err := NewPolicy(valid); err != nil {
+		t.Fatalf("NewPolicy(valid) = %v", err)
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	errs := FieldErrors{"password": "must be at least 8 characters", "email": "is not a valid email address"}
+	want := "email: is not a valid email address; password: must be at least 8 characters"
+	if got := errs.Error(); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Broadcaster carries channel messages and control events between server
+// instances and tracks who is online across all of them. Hubs publish
+// every chat message to it and deliver whatever it hands back, so a single
+// process uses MemoryBroadcaster and replicas share a RedisBroadcaster.
+type Broadcaster interface {
+	// Publish sends payload to every subscriber of topic, on any node.
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe calls handler for each payload published to topic until
+	// the returned cancel func is called.
+	Subscribe(topic string, handler func([]byte)) (cancel func(), err error)
+
+	// Join and Leave count a user's connections to a channel on this node.
+	Join(ctx context.Context, channelID, userID uint) error
+	Leave(ctx context.Context, channelID, userID uint) error
+	// Online returns the users connected to a channel on any live node.
+	Online(ctx context.Context, channelID uint) ([]uint, error)
+
+	// Ping checks the connection to the shared backend, if any.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// NewBroadcaster builds the driver named by driver: "memory" or "redis".
+func NewBroadcaster(driver string, redisCfg RedisConfig) (Broadcaster, error) {
+	switch driver {
+	case "memory", "":
+		return NewMemoryBroadcaster(), nil
+	case "redis":
+		return NewRedisBroadcaster(redisCfg)
+	default:
+		return nil, fmt.Errorf("unknown broadcaster %q", driver)
+	}
+}
+
+func channelTopic(channelID uint) string {
+	return fmt.Sprintf("channel:%d", channelID)
+}
+
+// controlTopic carries disconnect requests between nodes.
+const controlTopic = "control"
+
+// MemoryBroadcaster delivers within the current process only.
+type MemoryBroadcaster struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[string]map[int]func([]byte)
+	online   map[uint]map[uint]int
+}
+
+func NewMemoryBroadcaster() *MemoryBroadcaster {
+	return &MemoryBroadcaster{
+		handlers: make(map[string]map[int]func([]byte)),
+		online:   make(map[uint]map[uint]int),
+	}
+}
+
+func (b *MemoryBroadcaster) Publish(_ context.Context, topic string, payload []byte) error {
+	b.mu.RLock()
+	handlers := make([]func([]byte), 0, len(b.handlers[topic]))
+	for _, handler := range b.handlers[topic] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBroadcaster) Subscribe(topic string, handler func([]byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+	if b.handlers[topic] == nil {
+		b.handlers[topic] = make(map[int]func([]byte))
+	}
+	b.handlers[topic][id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers[topic], id)
+		if len(b.handlers[topic]) == 0 {
+			delete(b.handlers, topic)
+		}
+	}, nil
+}
+
+func (b *MemoryBroadcaster) Join(_ context.Context, channelID, userID uint) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.online[channelID] == nil {
+		b.online[channelID] = make(map[uint]int)
+	}
+	b.online[channelID][userID]++
+	return nil
+}
+
+func (b *MemoryBroadcaster) Leave(_ context.Context, channelID, userID uint) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	users := b.online[channelID]
+	if users == nil {
+		return nil
+	}
+	if users[userID]--; users[userID] <= 0 {
+		delete(users, userID)
+	}
+	if len(users) == 0 {
+		delete(b.online, channelID)
+	}
+	return nil
+}
+
+func (b *MemoryBroadcaster) Online(_ context.Context, channelID uint) ([]uint, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	users := make([]uint, 0, len(b.online[channelID]))
+	for userID := range b.online[channelID] {
+		users = append(users, userID)
+	}
+	return users, nil
+}
+
+func (b *MemoryBroadcaster) Ping(context.Context) error {
+	return nil
+}
+
+func (b *MemoryBroadcaster) Close() error {
+	return nil
+}
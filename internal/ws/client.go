@@ -1,16 +1,16 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
-)
-
-const (
-	writeWait  = 10 * time.Second
-	pongWait   = 60 * time.Second
-	pingPeriod = (pongWait * 9) / 10
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Message struct {
@@ -19,29 +19,93 @@ type Message struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// lastClientID numbers connections for the lifetime of the process.
+var lastClientID uint64
+
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	username string
+	id          uint64
+	hub         *Hub
+	conn        *websocket.Conn
+	send        chan []byte
+	userID      uint
+	username    string
+	sessionID   string
+	remoteAddr  string
+	connectedAt time.Time
+	logger      *slog.Logger
+	upgrade     trace.SpanContext
+	// closeFrame is set by the hub before it closes send.
+	closeFrame closeFrame
+}
+
+// ClientInfo is a point-in-time view of a connection for operators.
+type ClientInfo struct {
+	ID          uint64    `json:"id"`
+	ChannelID   uint      `json:"channel_id"`
+	UserID      uint      `json:"user_id"`
+	Username    string    `json:"username"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	QueueDepth  int       `json:"queue_depth"`
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, username string) *Client {
+// Peer identifies who is on the other end of a connection. Logger is the
+// upgrading request's logger, so connection logs share its request ID, and
+// Span is its trace span, which every message span links to.
+type Peer struct {
+	UserID     uint
+	Username   string
+	SessionID  string
+	RemoteAddr string
+	Logger     *slog.Logger
+	Span       trace.SpanContext
+}
+
+func NewClient(hub *Hub, conn *websocket.Conn, peer Peer) *Client {
+	id := atomic.AddUint64(&lastClientID, 1)
+	logger := peer.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 	return &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		username: username,
+		id:          id,
+		hub:         hub,
+		conn:        conn,
+		send:        make(chan []byte, hub.opts.SendBuffer),
+		userID:      peer.UserID,
+		username:    peer.Username,
+		sessionID:   peer.SessionID,
+		remoteAddr:  peer.RemoteAddr,
+		connectedAt: time.Now(),
+		logger:      logger.With("client_id", id, "channel_id", hub.channelID),
+		upgrade:     peer.Span,
+	}
+}
+
+func (c *Client) info() ClientInfo {
+	return ClientInfo{
+		ID:          c.id,
+		ChannelID:   c.hub.channelID,
+		UserID:      c.userID,
+		Username:    c.username,
+		RemoteAddr:  c.remoteAddr,
+		ConnectedAt: c.connectedAt,
+		QueueDepth:  len(c.send),
 	}
 }
 
 func (c *Client) ReadPump() {
+	var readErr error
 	defer func() {
 		c.hub.Unregister(c)
 		c.conn.Close()
+		c.logger.Info("websocket disconnected",
+			"duration_ms", time.Since(c.connectedAt).Milliseconds(),
+			"reason", disconnectReason(readErr))
 	}()
 
-	c.conn.SetReadLimit(1024)
+	pongWait := c.hub.opts.PongWait
+	c.conn.SetReadLimit(c.hub.opts.MaxMessageSize)
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -51,21 +115,41 @@ func (c *Client) ReadPump() {
 	for {
 		_, payload, err := c.conn.ReadMessage()
 		if err != nil {
+			readErr = err
 			break
 		}
 
-		msg := Message{
-			Sender:    c.username,
-			Content:   string(payload),
-			Timestamp: time.Now().Unix(),
-		}
-		encoded, _ := json.Marshal(msg)
-		c.hub.broadcast <- encoded
+		c.handleMessage(payload)
+	}
+}
+
+// handleMessage publishes one chat message. Each message is its own trace,
+// linked to the connection's upgrade request, so a long-lived connection
+// does not become one unbounded trace.
+func (c *Client) handleMessage(payload []byte) {
+	ctx, span := tracer.Start(context.Background(), "ws.message",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithLinks(trace.Link{SpanContext: c.upgrade}),
+		trace.WithAttributes(
+			attribute.Int64("channel.id", int64(c.hub.channelID)),
+			attribute.Int64("ws.client.id", int64(c.id)),
+			attribute.Int64("user.id", int64(c.userID)),
+			attribute.Int("ws.message.size", len(payload)),
+		))
+	defer span.End()
+
+	msg := Message{
+		Sender:    c.username,
+		Content:   string(payload),
+		Timestamp: time.Now().Unix(),
 	}
+	encoded, _ := json.Marshal(msg)
+	c.hub.publish(ctx, encoded)
 }
 
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	writeWait := c.hub.opts.WriteWait
+	ticker := time.NewTicker(c.hub.opts.PongWait * 9 / 10)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -76,7 +160,7 @@ func (c *Client) WritePump() {
 		case message, ok := <-c.send:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				_ = c.conn.WriteMessage(websocket.CloseMessage, c.closeFrame.message())
 				return
 			}
 			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
@@ -90,3 +174,16 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// disconnectReason describes why ReadPump stopped: the peer's close code, or
+// the read error when the connection was closed by this side or dropped.
+func disconnectReason(err error) string {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Error()
+	}
+	if err == nil {
+		return "unknown"
+	}
+	return err.Error()
+}
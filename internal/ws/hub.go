@@ -1,79 +1,292 @@
 package ws
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("webFianlBackend/internal/ws")
+
+// broadcasterTimeout bounds each publish and presence update.
+const broadcasterTimeout = 2 * time.Second
+
+// CloseChannelDeleted is the WebSocket close code sent when a channel is
+// deleted while members are connected.
+const CloseChannelDeleted = 4404
+
+// ErrHubClosed is returned by Register when the hub shut down before the
+// client could join; the caller should close the connection.
+var ErrHubClosed = errors.New("hub closed")
+
+// ErrShuttingDown is returned by Manager.Get once Shutdown has begun.
+var ErrShuttingDown = errors.New("server shutting down")
+
 type Hub struct {
-	channelID uint
-	clients   map[*Client]bool
-	broadcast chan []byte
-	register  chan *Client
+	channelID   uint
+	broadcaster Broadcaster
+	unsubscribe func()
+	// retire asks the manager to forget this hub once it has been idle. It
+	// refuses while pending > 0, i.e. while a Get caller may still register.
+	retire  func(*Hub) bool
+	opts    Options
+	pending atomic.Int32
+	// conns is the manager's count of connections that Shutdown waits for.
+	conns    *sync.WaitGroup
+	counters *hubCounters
+
+	clients    map[*Client]bool
+	broadcast  chan []byte
+	register   chan *Client
 	unregister chan *Client
+	disconnect chan disconnectRequest
+	inspect    chan chan []ClientInfo
+	stop       chan closeFrame
+	done       chan struct{}
+}
+
+// hubCounters are shared by all hubs of a Manager and read by Metrics.
+type hubCounters struct {
+	connections atomic.Int64
+	published   atomic.Uint64
+	delivered   atomic.Uint64
+	slowDropped atomic.Uint64
 }
 
-func newHub(channelID uint) *Hub {
+// disconnectRequest asks the hub to drop matching clients; the number
+// dropped is sent on done.
+type disconnectRequest struct {
+	match func(*Client) bool
+	done  chan int
+}
+
+// closeFrame is the code and reason sent to clients when a hub stops.
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+// HubInfo summarizes a live hub.
+type HubInfo struct {
+	ChannelID uint `json:"channel_id"`
+	Clients   int  `json:"clients"`
+}
+
+func newHub(channelID uint, broadcaster Broadcaster, opts Options) *Hub {
 	return &Hub{
-		channelID: channelID,
-		clients:   make(map[*Client]bool),
-		broadcast: make(chan []byte),
-		register:  make(chan *Client),
-		unregister: make(chan *Client),
+		channelID:   channelID,
+		broadcaster: broadcaster,
+		opts:        opts,
+		clients:     make(map[*Client]bool),
+		broadcast:   make(chan []byte),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		disconnect:  make(chan disconnectRequest),
+		inspect:     make(chan chan []ClientInfo),
+		stop:        make(chan closeFrame),
+		done:        make(chan struct{}),
 	}
 }
 
 func (h *Hub) run() {
+	defer close(h.done)
+	defer h.unsubscribe()
+
+	// idle fires once the hub has had no clients for opts.IdleTimeout.
+	var idle *time.Timer
+	var idleC <-chan time.Time
+	checkIdle := func() {
+		switch {
+		case len(h.clients) == 0 && idle == nil:
+			idle = time.NewTimer(h.opts.IdleTimeout)
+			idleC = idle.C
+		case len(h.clients) > 0 && idle != nil:
+			idle.Stop()
+			idle, idleC = nil, nil
+		}
+	}
+	checkIdle()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.clients[client] = true
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.drop(client, closeFrame{})
+			}
+		case req := <-h.disconnect:
+			dropped := 0
+			for client := range h.clients {
+				if req.match(client) {
+					h.drop(client, closeFrame{})
+					dropped++
+				}
+			}
+			req.done <- dropped
+		case reply := <-h.inspect:
+			infos := make([]ClientInfo, 0, len(h.clients))
+			for client := range h.clients {
+				infos = append(infos, client.info())
 			}
+			reply <- infos
 		case message := <-h.broadcast:
 			for client := range h.clients {
 				select {
 				case client.send <- message:
+					h.counters.delivered.Add(1)
 				default:
-					delete(h.clients, client)
-					close(client.send)
+					h.drop(client, closeFrame{})
+					h.counters.slowDropped.Add(1)
 				}
 			}
+		case frame := <-h.stop:
+			for client := range h.clients {
+				h.drop(client, frame)
+			}
+			if idle != nil {
+				idle.Stop()
+			}
+			return
+		case <-idleC:
+			idle, idleC = nil, nil
+			if h.retire(h) {
+				return
+			}
 		}
+		checkIdle()
 	}
 }
 
-func (h *Hub) Register(client *Client) {
-	h.register <- client
+// drop removes a client and closes its send queue, which makes WritePump
+// send frame (an empty close frame when frame is zero) and hang up.
+func (h *Hub) drop(client *Client, frame closeFrame) {
+	delete(h.clients, client)
+	client.closeFrame = frame
+	close(client.send)
+}
+
+// Register adds a client obtained through Manager.Get. On success the
+// client must later be passed to Unregister, which ReadPump does. Its span
+// shows how long the client waited for the hub's loop and for presence.
+func (h *Hub) Register(ctx context.Context, client *Client) error {
+	ctx, span := tracer.Start(ctx, "ws.hub.register", trace.WithAttributes(
+		attribute.Int64("channel.id", int64(h.channelID)),
+		attribute.Int64("ws.client.id", int64(client.id)),
+	))
+	defer span.End()
+
+	defer h.pending.Add(-1)
+	select {
+	case h.register <- client:
+	case <-h.done:
+		h.conns.Done()
+		span.SetStatus(codes.Error, ErrHubClosed.Error())
+		return ErrHubClosed
+	}
+	span.AddEvent("registered")
+	h.counters.connections.Add(1)
+	client.logger.Info("websocket connected", "remote_addr", client.remoteAddr)
+
+	ctx, cancel := context.WithTimeout(ctx, broadcasterTimeout)
+	defer cancel()
+	if err := h.broadcaster.Join(ctx, h.channelID, client.userID); err != nil {
+		client.logger.Warn("presence join failed", "error", err)
+		span.RecordError(err)
+	}
+	return nil
+}
+
+// Release gives back a Manager.Get that will not be followed by Register,
+// e.g. because the WebSocket upgrade failed.
+func (h *Hub) Release() {
+	h.pending.Add(-1)
+	h.conns.Done()
 }
 
 func (h *Hub) Unregister(client *Client) {
-	h.unregister <- client
+	defer h.conns.Done()
+	h.counters.connections.Add(-1)
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), broadcasterTimeout)
+	defer cancel()
+	if err := h.broadcaster.Leave(ctx, h.channelID, client.userID); err != nil {
+		client.logger.Warn("presence leave failed", "error", err)
+	}
 }
 
-type Manager struct {
-	mu   sync.Mutex
-	hubs map[uint]*Hub
+// publish hands a message to the broadcaster, which delivers it back to this
+// hub and to the channel's hubs on other nodes. With MemoryBroadcaster the
+// call includes waiting for the hub's loop to accept the message.
+func (h *Hub) publish(ctx context.Context, message []byte) {
+	h.counters.published.Add(1)
+	ctx, cancel := context.WithTimeout(ctx, broadcasterTimeout)
+	defer cancel()
+	if err := h.broadcaster.Publish(ctx, channelTopic(h.channelID), message); err != nil {
+		slog.Warn("publish failed", "channel_id", h.channelID, "error", err)
+		trace.SpanFromContext(ctx).RecordError(err)
+	}
 }
 
-func NewManager() *Manager {
-	return &Manager{
-		hubs: make(map[uint]*Hub),
+// deliver passes a message from the broadcaster to the local clients.
+func (h *Hub) deliver(message []byte) {
+	select {
+	case h.broadcast <- message:
+	case <-h.done:
 	}
 }
 
-func (m *Manager) Get(channelID uint) *Hub {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Disconnect closes every client for which match returns true and reports
+// how many were closed.
+func (h *Hub) Disconnect(match func(*Client) bool) int {
+	done := make(chan int, 1)
+	select {
+	case h.disconnect <- disconnectRequest{match: match, done: done}:
+		return <-done
+	case <-h.done:
+		return 0
+	}
+}
 
-	if hub, ok := m.hubs[channelID]; ok {
-		return hub
+// Clients returns a snapshot of the connected clients, oldest first.
+func (h *Hub) Clients() []ClientInfo {
+	reply := make(chan []ClientInfo, 1)
+	select {
+	case h.inspect <- reply:
+	case <-h.done:
+		return []ClientInfo{}
 	}
+	infos := <-reply
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
 
-	hub := newHub(channelID)
-	m.hubs[channelID] = hub
-	go hub.run()
-	return hub
+// close stops the hub, sending every client a close frame with code and
+// reason, and waits for it to finish.
+func (h *Hub) close(code int, reason string) {
+	select {
+	case h.stop <- closeFrame{code: code, reason: reason}:
+	case <-h.done:
+	}
+	<-h.done
+}
+
+func (f closeFrame) message() []byte {
+	if f.code == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(f.code, f.reason)
 }
@@ -0,0 +1,385 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webFianlBackend/internal/utils"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options tune hubs and their connections. Zero fields take the defaults
+// below.
+type Options struct {
+	// IdleTimeout is how long an empty hub lingers before it stops.
+	IdleTimeout time.Duration
+	// WriteWait bounds each write to a client. PongWait is how long a
+	// client may stay silent; pings are sent at 9/10 of it.
+	WriteWait time.Duration
+	PongWait  time.Duration
+	// MaxMessageSize is the largest message accepted from a client, in
+	// bytes. SendBuffer is how many outgoing messages may queue for a
+	// client before it is dropped as too slow.
+	MaxMessageSize int64
+	SendBuffer     int
+}
+
+// DefaultOptions are used for unset Options fields.
+var DefaultOptions = Options{
+	IdleTimeout:    5 * time.Minute,
+	WriteWait:      10 * time.Second,
+	PongWait:       60 * time.Second,
+	MaxMessageSize: 1024,
+	SendBuffer:     256,
+}
+
+func (o Options) withDefaults() Options {
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = DefaultOptions.IdleTimeout
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = DefaultOptions.WriteWait
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = DefaultOptions.PongWait
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = DefaultOptions.MaxMessageSize
+	}
+	if o.SendBuffer <= 0 {
+		o.SendBuffer = DefaultOptions.SendBuffer
+	}
+	return o
+}
+
+type Manager struct {
+	mu          sync.Mutex
+	hubs        map[uint]*Hub
+	broadcaster Broadcaster
+	opts        Options
+	// origin tags this process's control events so it can skip its own.
+	origin string
+	// closing is set by Shutdown; conns counts connections between Get and
+	// Unregister so Shutdown can wait for them.
+	closing bool
+	conns   sync.WaitGroup
+	// draining is set by Drain or Shutdown and read by readiness probes.
+	draining atomic.Bool
+
+	hubsStarted atomic.Uint64
+	hubsStopped atomic.Uint64
+	counters    hubCounters
+}
+
+// ManagerMetrics counts hubs, connections and messages on this node.
+type ManagerMetrics struct {
+	LiveHubs           int    `json:"live_hubs"`
+	Connections        int64  `json:"connections"`
+	HubsStarted        uint64 `json:"hubs_started"`
+	HubsStopped        uint64 `json:"hubs_stopped"`
+	MessagesPublished  uint64 `json:"messages_published"`
+	MessagesDelivered  uint64 `json:"messages_delivered"`
+	SlowClientsDropped uint64 `json:"slow_clients_dropped"`
+}
+
+// controlEvent asks every other node to close matching connections, or a
+// whole channel.
+type controlEvent struct {
+	Origin     string   `json:"origin"`
+	SessionIDs []string `json:"session_ids,omitempty"`
+	UserID     uint     `json:"user_id,omitempty"`
+	ChannelID  uint     `json:"channel_id,omitempty"`
+	Code       int      `json:"code,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+// NewManager returns a manager whose hubs and connections are tuned by opts.
+func NewManager(broadcaster Broadcaster, opts Options) (*Manager, error) {
+	origin, err := utils.RandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manager{
+		hubs:        make(map[uint]*Hub),
+		broadcaster: broadcaster,
+		opts:        opts.withDefaults(),
+		origin:      origin,
+	}
+	if _, err := broadcaster.Subscribe(controlTopic, m.handleControl); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Get returns the channel's hub, starting one if needed. The caller must
+// follow up with Register, which may return ErrHubClosed if the channel was
+// closed in between, or with Release. After Shutdown it returns
+// ErrShuttingDown. A new hub is only started once it is subscribed to the
+// broadcaster, since every message, even between local clients, comes back
+// through it; otherwise the subscribe error is returned.
+func (m *Manager) Get(ctx context.Context, channelID uint) (*Hub, error) {
+	_, span := tracer.Start(ctx, "ws.hub.get", trace.WithAttributes(attribute.Int64("channel.id", int64(channelID))))
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closing {
+		span.SetStatus(codes.Error, ErrShuttingDown.Error())
+		return nil, ErrShuttingDown
+	}
+	if hub, ok := m.hubs[channelID]; ok {
+		m.conns.Add(1)
+		hub.pending.Add(1)
+		return hub, nil
+	}
+	span.SetAttributes(attribute.Bool("ws.hub.created", true))
+
+	hub := newHub(channelID, m.broadcaster, m.opts)
+	hub.retire = m.retire
+	hub.conns = &m.conns
+	hub.counters = &m.counters
+	unsubscribe, err := m.broadcaster.Subscribe(channelTopic(channelID), hub.deliver)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("subscribe to channel %d: %w", channelID, err)
+	}
+	hub.unsubscribe = unsubscribe
+	m.conns.Add(1)
+	hub.pending.Add(1)
+	m.hubs[channelID] = hub
+	m.hubsStarted.Add(1)
+	go hub.run()
+	return hub, nil
+}
+
+// Drain marks this node as going away so readiness checks fail and load
+// balancers stop routing to it. Existing and new connections are still
+// served until Shutdown.
+func (m *Manager) Drain() {
+	m.draining.Store(true)
+}
+
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// PingBroadcaster checks the broadcaster's connection to its backend.
+func (m *Manager) PingBroadcaster(ctx context.Context) error {
+	return m.broadcaster.Ping(ctx)
+}
+
+// Shutdown closes every hub on this node, sending clients close code 1012
+// so they reconnect (to another instance), and waits until their
+// connections have finished or ctx expires. Other nodes are not affected.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.draining.Store(true)
+	m.mu.Lock()
+	m.closing = true
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for channelID, hub := range m.hubs {
+		hubs = append(hubs, hub)
+		delete(m.hubs, channelID)
+		m.hubsStopped.Add(1)
+	}
+	m.mu.Unlock()
+
+	for _, hub := range hubs {
+		hub.close(websocket.CloseServiceRestart, "server restarting, reconnect")
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		m.conns.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retire removes an idle hub unless a Get caller is about to register.
+func (m *Manager) retire(hub *Hub) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hub.pending.Load() > 0 {
+		return false
+	}
+	if m.hubs[hub.channelID] == hub {
+		delete(m.hubs, hub.channelID)
+		m.hubsStopped.Add(1)
+	}
+	return true
+}
+
+// CloseChannel stops the channel's hub on every node, sending connected
+// clients a close frame with code and reason.
+func (m *Manager) CloseChannel(channelID uint, code int, reason string) {
+	m.closeChannel(channelID, code, reason)
+	m.publishControl(controlEvent{ChannelID: channelID, Code: code, Reason: reason})
+}
+
+func (m *Manager) closeChannel(channelID uint, code int, reason string) {
+	m.mu.Lock()
+	hub, ok := m.hubs[channelID]
+	if ok {
+		delete(m.hubs, channelID)
+		m.hubsStopped.Add(1)
+	}
+	m.mu.Unlock()
+
+	if ok {
+		hub.close(code, reason)
+	}
+}
+
+// Metrics reports the counters of this node.
+func (m *Manager) Metrics() ManagerMetrics {
+	m.mu.Lock()
+	live := len(m.hubs)
+	m.mu.Unlock()
+
+	return ManagerMetrics{
+		LiveHubs:           live,
+		Connections:        m.counters.connections.Load(),
+		HubsStarted:        m.hubsStarted.Load(),
+		HubsStopped:        m.hubsStopped.Load(),
+		MessagesPublished:  m.counters.published.Load(),
+		MessagesDelivered:  m.counters.delivered.Load(),
+		SlowClientsDropped: m.counters.slowDropped.Load(),
+	}
+}
+
+// Online lists the users connected to a channel on any node.
+func (m *Manager) Online(ctx context.Context, channelID uint) ([]uint, error) {
+	return m.broadcaster.Online(ctx, channelID)
+}
+
+// Lookup returns the hub for channelID if one is running. Unlike Get it never
+// starts a hub.
+func (m *Manager) Lookup(channelID uint) (*Hub, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hub, ok := m.hubs[channelID]
+	return hub, ok
+}
+
+// Hubs summarizes every running hub, ordered by channel.
+func (m *Manager) Hubs() []HubInfo {
+	hubs := m.snapshot()
+	infos := make([]HubInfo, 0, len(hubs))
+	for _, hub := range hubs {
+		infos = append(infos, HubInfo{ChannelID: hub.channelID, Clients: len(hub.Clients())})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ChannelID < infos[j].ChannelID })
+	return infos
+}
+
+// DisconnectSessions closes every live connection authenticated with one of
+// the given sessions, across all hubs.
+func (m *Manager) DisconnectSessions(sessionIDs ...string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+
+	m.disconnect(func(c *Client) bool {
+		return revoked[c.sessionID]
+	})
+	m.publishControl(controlEvent{SessionIDs: sessionIDs})
+}
+
+// DisconnectLocalClient closes the connection with the given client ID on
+// this node and returns what it was, or false if no such client is
+// connected here. Client IDs are only unique per process, so unlike the
+// other disconnects this is not sent to other nodes.
+func (m *Manager) DisconnectLocalClient(clientID uint64) (ClientInfo, bool) {
+	var closed ClientInfo
+	n := m.disconnect(func(c *Client) bool {
+		if c.id != clientID {
+			return false
+		}
+		closed = c.info()
+		return true
+	})
+	return closed, n > 0
+}
+
+// DisconnectUser closes all of a user's connections on every node and
+// returns how many were closed on this one.
+func (m *Manager) DisconnectUser(userID uint) int {
+	closed := m.disconnect(func(c *Client) bool {
+		return c.userID == userID
+	})
+	m.publishControl(controlEvent{UserID: userID})
+	return closed
+}
+
+func (m *Manager) publishControl(event controlEvent) {
+	event.Origin = m.origin
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), broadcasterTimeout)
+	defer cancel()
+	if err := m.broadcaster.Publish(ctx, controlTopic, payload); err != nil {
+		slog.Warn("publish control event failed", "error", err)
+	}
+}
+
+func (m *Manager) handleControl(payload []byte) {
+	var event controlEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.Origin == m.origin {
+		return
+	}
+	if event.ChannelID != 0 {
+		m.closeChannel(event.ChannelID, event.Code, event.Reason)
+		return
+	}
+	revoked := make(map[string]bool, len(event.SessionIDs))
+	for _, id := range event.SessionIDs {
+		revoked[id] = true
+	}
+	m.disconnect(func(c *Client) bool {
+		return revoked[c.sessionID] || (event.UserID != 0 && c.userID == event.UserID)
+	})
+}
+
+func (m *Manager) disconnect(match func(*Client) bool) int {
+	dropped := 0
+	for _, hub := range m.snapshot() {
+		dropped += hub.Disconnect(match)
+	}
+	return dropped
+}
+
+// snapshot copies the hub list so hubs can be queried without holding mu.
+func (m *Manager) snapshot() []*Hub {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hubs := make([]*Hub, 0, len(m.hubs))
+	for _, hub := range m.hubs {
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
@@ -0,0 +1,68 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingBroadcaster refuses subscriptions to channel topics.
+type failingBroadcaster struct {
+	*MemoryBroadcaster
+}
+
+var errSubscribe = errors.New("subscribe refused")
+
+func (b failingBroadcaster) Subscribe(topic string, handler func([]byte)) (func(), error) {
+	if strings.HasPrefix(topic, "channel:") {
+		return nil, errSubscribe
+	}
+	return b.MemoryBroadcaster.Subscribe(topic, handler)
+}
+
+func TestGetFailsWithoutSubscription(t *testing.T) {
+	m, err := NewManager(failingBroadcaster{NewMemoryBroadcaster()}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Get(context.Background(), 1); !errors.Is(err, errSubscribe) {
+		t.Fatalf("Get = %v, want the subscribe error", err)
+	}
+	if _, ok := m.Lookup(1); ok {
+		t.Fatal("a hub that cannot receive messages was kept")
+	}
+	if started := m.Metrics().HubsStarted; started != 0 {
+		t.Fatalf("HubsStarted = %d, want 0", started)
+	}
+
+	// The failed Get left no connection for Shutdown to wait for.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	m, err := NewManager(NewMemoryBroadcaster(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub, err := m.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.Release()
+	if !m.retire(hub) {
+		t.Fatal("a released hub still counts a pending Get")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+}
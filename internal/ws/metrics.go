@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	hubsDesc = prometheus.NewDesc("ws_hubs",
+		"Channel hubs running on this node.", nil, nil)
+	connectionsDesc = prometheus.NewDesc("ws_connections",
+		"WebSocket connections open on this node.", nil, nil)
+	hubsStartedDesc = prometheus.NewDesc("ws_hubs_started_total",
+		"Channel hubs started.", nil, nil)
+	hubsStoppedDesc = prometheus.NewDesc("ws_hubs_stopped_total",
+		"Channel hubs stopped after idling, deletion or shutdown.", nil, nil)
+	publishedDesc = prometheus.NewDesc("ws_messages_published_total",
+		"Chat messages published by clients on this node.", nil, nil)
+	deliveredDesc = prometheus.NewDesc("ws_messages_delivered_total",
+		"Chat messages queued to local clients.", nil, nil)
+	slowDroppedDesc = prometheus.NewDesc("ws_slow_clients_dropped_total",
+		"Clients disconnected because their send queue was full.", nil, nil)
+)
+
+// Describe and Collect make the Manager a prometheus.Collector, read from
+// the same counters as Metrics.
+
+func (m *Manager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hubsDesc
+	ch <- connectionsDesc
+	ch <- hubsStartedDesc
+	ch <- hubsStoppedDesc
+	ch <- publishedDesc
+	ch <- deliveredDesc
+	ch <- slowDroppedDesc
+}
+
+func (m *Manager) Collect(ch chan<- prometheus.Metric) {
+	s := m.Metrics()
+	ch <- prometheus.MustNewConstMetric(hubsDesc, prometheus.GaugeValue, float64(s.LiveHubs))
+	ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(s.Connections))
+	ch <- prometheus.MustNewConstMetric(hubsStartedDesc, prometheus.CounterValue, float64(s.HubsStarted))
+	ch <- prometheus.MustNewConstMetric(hubsStoppedDesc, prometheus.CounterValue, float64(s.HubsStopped))
+	ch <- prometheus.MustNewConstMetric(publishedDesc, prometheus.CounterValue, float64(s.MessagesPublished))
+	ch <- prometheus.MustNewConstMetric(deliveredDesc, prometheus.CounterValue, float64(s.MessagesDelivered))
+	ch <- prometheus.MustNewConstMetric(slowDroppedDesc, prometheus.CounterValue, float64(s.SlowClientsDropped))
+}
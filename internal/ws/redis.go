@@ -0,0 +1,390 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"webFianlBackend/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// nodeHeartbeat is how often a node refreshes its liveness entry;
+	// presence from nodes silent for nodeTTL is ignored and cleaned up.
+	nodeHeartbeat = 10 * time.Second
+	nodeTTL       = 3 * nodeHeartbeat
+
+	// topicQueue is how many received messages may wait for a topic's
+	// handlers before further ones are dropped.
+	topicQueue = 256
+)
+
+type RedisConfig struct {
+	URL string
+	// Prefix namespaces keys and pub/sub channels, so several deployments
+	// can share one Redis.
+	Prefix string
+	// NodeID identifies this instance in presence data. It defaults to the
+	// hostname plus a random suffix, unique per process start.
+	NodeID string
+}
+
+// RedisBroadcaster shares messages and presence between replicas through
+// Redis pub/sub. Presence lives in one hash per channel, keyed by
+// node and user, next to a sorted set of node heartbeats; entries of dead
+// nodes are skipped and removed on read.
+type RedisBroadcaster struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+	prefix string
+	node   string
+
+	mu     sync.RWMutex
+	nextID int
+	topics map[string]*redisTopic
+	local  map[uint]map[uint]int
+	// dropped counts messages discarded because a topic's queue was full.
+	dropped atomic.Uint64
+	// subMu serializes subscription changes, so a topic's SUBSCRIBE and
+	// UNSUBSCRIBE reach Redis in the order its handler count changed.
+	subMu sync.Mutex
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewRedisBroadcaster(cfg RedisConfig) (*RedisBroadcaster, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse REDIS_URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis: %w", err)
+	}
+
+	node := cfg.NodeID
+	if node == "" {
+		host, _ := os.Hostname()
+		suffix, err := utils.RandomToken(4)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		node = host + "-" + suffix
+	}
+
+	b := &RedisBroadcaster{
+		client: client,
+		pubsub: client.Subscribe(context.Background()),
+		prefix: cfg.Prefix,
+		node:   node,
+		topics: make(map[string]*redisTopic),
+		local:  make(map[uint]map[uint]int),
+		stop:   make(chan struct{}),
+	}
+	b.heartbeat()
+
+	b.wg.Add(2)
+	go b.dispatch()
+	go b.beat()
+	return b, nil
+}
+
+func (b *RedisBroadcaster) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, b.prefix+topic, payload).Err()
+}
+
+// redisTopic holds a subscribed topic's handlers and the messages waiting
+// for them. Each topic is drained by its own goroutine, so a handler that
+// blocks, such as a busy hub's deliver, only holds up its own topic.
+type redisTopic struct {
+	handlers map[int]func([]byte)
+	queue    chan []byte
+	stop     chan struct{}
+}
+
+func (b *RedisBroadcaster) Subscribe(topic string, handler func([]byte)) (func(), error) {
+	name := b.prefix + topic
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	id, first := b.add(name, handler)
+	if first {
+		if err := b.pubsub.Subscribe(context.Background(), name); err != nil {
+			b.remove(name, id)
+			return nil, err
+		}
+	}
+
+	return func() {
+		b.subMu.Lock()
+		defer b.subMu.Unlock()
+		if b.remove(name, id) {
+			if err := b.pubsub.Unsubscribe(context.Background(), name); err != nil {
+				slog.Warn("redis unsubscribe failed", "topic", name, "error", err)
+			}
+		}
+	}, nil
+}
+
+// add registers a handler, starting the topic's goroutine if it is the
+// first, and reports its ID and whether it was.
+func (b *RedisBroadcaster) add(name string, handler func([]byte)) (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	t, ok := b.topics[name]
+	if !ok {
+		t = &redisTopic{
+			handlers: make(map[int]func([]byte)),
+			queue:    make(chan []byte, topicQueue),
+			stop:     make(chan struct{}),
+		}
+		b.topics[name] = t
+		b.wg.Add(1)
+		go b.drain(t)
+	}
+	t.handlers[b.nextID] = handler
+	return b.nextID, !ok
+}
+
+// remove drops one handler and reports whether it was the topic's last.
+func (b *RedisBroadcaster) remove(name string, id int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topics[name]
+	delete(t.handlers, id)
+	if len(t.handlers) > 0 {
+		return false
+	}
+	delete(b.topics, name)
+	close(t.stop)
+	return true
+}
+
+func (b *RedisBroadcaster) dispatch() {
+	defer b.wg.Done()
+	for msg := range b.pubsub.Channel() {
+		b.route(msg.Channel, []byte(msg.Payload))
+	}
+}
+
+// route queues payload for the topic's handlers without waiting, dropping it
+// when the queue is full so other topics keep flowing.
+func (b *RedisBroadcaster) route(name string, payload []byte) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	t, ok := b.topics[name]
+	if !ok {
+		return
+	}
+	select {
+	case t.queue <- payload:
+	default:
+		if b.dropped.Add(1)%topicQueue == 1 {
+			slog.Warn("redis topic queue full, dropping messages", "topic", name, "dropped", b.dropped.Load())
+		}
+	}
+}
+
+// drain passes a topic's queued messages to its handlers until the topic is
+// unsubscribed or the broadcaster closes.
+func (b *RedisBroadcaster) drain(t *redisTopic) {
+	defer b.wg.Done()
+	for {
+		select {
+		case payload := <-t.queue:
+			b.mu.RLock()
+			handlers := make([]func([]byte), 0, len(t.handlers))
+			for _, handler := range t.handlers {
+				handlers = append(handlers, handler)
+			}
+			b.mu.RUnlock()
+
+			for _, handler := range handlers {
+				handler(payload)
+			}
+		case <-t.stop:
+			return
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Dropped reports how many received messages were discarded because their
+// topic's handlers fell behind.
+func (b *RedisBroadcaster) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+func (b *RedisBroadcaster) beat() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(nodeHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.heartbeat()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *RedisBroadcaster) heartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), nodeHeartbeat)
+	defer cancel()
+	added, err := b.client.ZAdd(ctx, b.prefix+"nodes", redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: b.node,
+	}).Result()
+	if err != nil {
+		slog.Warn("redis heartbeat failed", "error", err)
+		return
+	}
+	cutoff := strconv.FormatInt(time.Now().Add(-nodeTTL).Unix(), 10)
+	_ = b.client.ZRemRangeByScore(ctx, b.prefix+"nodes", "-inf", "("+cutoff).Err()
+
+	// After an outage long enough for other nodes to drop this one, its
+	// presence entries may be gone too; write them back.
+	if added > 0 {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+		for channelID, users := range b.local {
+			for userID, count := range users {
+				_ = b.client.HSet(ctx, b.presenceKey(channelID), b.presenceField(userID), count).Err()
+			}
+		}
+	}
+}
+
+func (b *RedisBroadcaster) presenceKey(channelID uint) string {
+	return b.prefix + "presence:" + strconv.FormatUint(uint64(channelID), 10)
+}
+
+func (b *RedisBroadcaster) presenceField(userID uint) string {
+	return b.node + "|" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func (b *RedisBroadcaster) Join(ctx context.Context, channelID, userID uint) error {
+	b.mu.Lock()
+	if b.local[channelID] == nil {
+		b.local[channelID] = make(map[uint]int)
+	}
+	b.local[channelID][userID]++
+	b.mu.Unlock()
+
+	return b.client.HIncrBy(ctx, b.presenceKey(channelID), b.presenceField(userID), 1).Err()
+}
+
+func (b *RedisBroadcaster) Leave(ctx context.Context, channelID, userID uint) error {
+	b.mu.Lock()
+	if users := b.local[channelID]; users != nil {
+		if users[userID]--; users[userID] <= 0 {
+			delete(users, userID)
+		}
+		if len(users) == 0 {
+			delete(b.local, channelID)
+		}
+	}
+	b.mu.Unlock()
+
+	key, field := b.presenceKey(channelID), b.presenceField(userID)
+	n, err := b.client.HIncrBy(ctx, key, field, -1).Result()
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return b.client.HDel(ctx, key, field).Err()
+	}
+	return nil
+}
+
+func (b *RedisBroadcaster) Online(ctx context.Context, channelID uint) ([]uint, error) {
+	cutoff := strconv.FormatInt(time.Now().Add(-nodeTTL).Unix(), 10)
+	nodes, err := b.client.ZRangeByScore(ctx, b.prefix+"nodes", &redis.ZRangeBy{Min: cutoff, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	alive := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		alive[node] = true
+	}
+
+	key := b.presenceKey(channelID)
+	entries, err := b.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool)
+	var stale []string
+	for field, count := range entries {
+		node, rawID, ok := strings.Cut(field, "|")
+		if !ok || !alive[node] {
+			stale = append(stale, field)
+			continue
+		}
+		if n, _ := strconv.Atoi(count); n <= 0 {
+			continue
+		}
+		if id, err := strconv.ParseUint(rawID, 10, 64); err == nil {
+			seen[uint(id)] = true
+		}
+	}
+	if len(stale) > 0 {
+		_ = b.client.HDel(ctx, key, stale...).Err()
+	}
+
+	users := make([]uint, 0, len(seen))
+	for id := range seen {
+		users = append(users, id)
+	}
+	return users, nil
+}
+
+// Ping checks the connection to Redis.
+func (b *RedisBroadcaster) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+// Close withdraws this node's presence and liveness before disconnecting.
+func (b *RedisBroadcaster) Close() error {
+	close(b.stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b.mu.Lock()
+	for channelID, users := range b.local {
+		for userID := range users {
+			_ = b.client.HDel(ctx, b.presenceKey(channelID), b.presenceField(userID)).Err()
+		}
+	}
+	b.mu.Unlock()
+	_ = b.client.ZRem(ctx, b.prefix+"nodes", b.node).Err()
+
+	err := b.pubsub.Close()
+	b.wg.Wait()
+	if cerr := b.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,293 @@
+package ws
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"webFianlBackend/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis connects to REDIS_URL, or a local Redis, and skips the test
+// when there is none. Broadcasters of one test share a prefix of their own.
+func newTestRedis(t *testing.T, prefix, node string) *RedisBroadcaster {
+	t.Helper()
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		url = "redis://localhost:6379/15"
+	}
+	b, err := NewRedisBroadcaster(RedisConfig{URL: url, Prefix: prefix, NodeID: node})
+	if err != nil {
+		t.Skipf("redis unavailable: %v", err)
+	}
+	return b
+}
+
+func testPrefix(t *testing.T) string {
+	t.Helper()
+	suffix, err := utils.RandomToken(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "test:" + t.Name() + ":" + suffix + ":"
+}
+
+// waitSubscribers waits until n connections are subscribed to topic, since
+// go-redis sends SUBSCRIBE without waiting for the reply.
+func waitSubscribers(t *testing.T, b *RedisBroadcaster, topic string, n int64) {
+	t.Helper()
+	ctx := context.Background()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		counts, err := b.client.PubSubNumSub(ctx, b.prefix+topic).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts[b.prefix+topic] == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d subscribers, want %d", topic, counts[b.prefix+topic], n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func sortedOnline(t *testing.T, b Broadcaster, channelID uint) []uint {
+	t.Helper()
+	users, err := b.Online(context.Background(), channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	return users
+}
+
+// register connects a client without a socket, so the test reads what the
+// hub sends it from its queue.
+func register(t *testing.T, m *Manager, channelID, userID uint) *Client {
+	t.Helper()
+	ctx := context.Background()
+	hub, err := m.Get(ctx, channelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(hub, nil, Peer{UserID: userID, SessionID: "session-" + strconv.Itoa(int(userID))})
+	if err := hub.Register(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func receive(t *testing.T, client *Client) ([]byte, bool) {
+	t.Helper()
+	select {
+	case message, ok := <-client.send:
+		return message, ok
+	case <-time.After(2 * time.Second):
+		t.Fatalf("client %d received nothing", client.id)
+		return nil, false
+	}
+}
+
+func TestRedisFanOutBetweenManagers(t *testing.T) {
+	prefix := testPrefix(t)
+	a := newTestRedis(t, prefix, "node-a")
+	defer a.Close()
+	b := newTestRedis(t, prefix, "node-b")
+	defer b.Close()
+
+	managerA, err := NewManager(a, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	managerB, err := NewManager(b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientA := register(t, managerA, 1, 10)
+	clientB := register(t, managerB, 1, 11)
+	waitSubscribers(t, a, channelTopic(1), 2)
+	waitSubscribers(t, a, controlTopic, 2)
+
+	hubA, _ := managerA.Lookup(1)
+	hubA.publish(context.Background(), []byte("hello"))
+	for _, client := range []*Client{clientA, clientB} {
+		if message, ok := receive(t, client); !ok || string(message) != "hello" {
+			t.Fatalf("client of user %d got %q, %v", client.userID, message, ok)
+		}
+	}
+
+	if closed := managerA.DisconnectUser(11); closed != 0 {
+		t.Fatalf("DisconnectUser closed %d on node A, want 0", closed)
+	}
+	if _, ok := receive(t, clientB); ok {
+		t.Fatal("node B kept the user's connection after DisconnectUser on node A")
+	}
+}
+
+func TestRedisResubscribe(t *testing.T) {
+	b := newTestRedis(t, testPrefix(t), "node-a")
+	defer b.Close()
+
+	cancel, err := b.Subscribe("topic", func([]byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	got := make(chan []byte, 1)
+	cancel, err = b.Subscribe("topic", func(payload []byte) { got <- payload })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	waitSubscribers(t, b, "topic", 1)
+
+	if err := b.Publish(context.Background(), "topic", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case payload := <-got:
+		if string(payload) != "again" {
+			t.Fatalf("handler got %q", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler subscribed after a cancel received nothing")
+	}
+}
+
+func TestRedisOnlineAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	prefix := testPrefix(t)
+	a := newTestRedis(t, prefix, "node-a")
+	b := newTestRedis(t, prefix, "node-b")
+	defer b.Close()
+
+	for _, join := range []struct {
+		node   Broadcaster
+		userID uint
+	}{{a, 10}, {a, 10}, {b, 10}, {b, 11}} {
+		if err := join.node.Join(ctx, 1, join.userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := sortedOnline(t, a, 1); !reflect.DeepEqual(got, []uint{10, 11}) {
+		t.Fatalf("Online on node A = %v, want [10 11]", got)
+	}
+
+	if err := b.Leave(ctx, 1, 11); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Leave(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedOnline(t, b, 1); !reflect.DeepEqual(got, []uint{10}) {
+		t.Fatalf("Online on node B = %v, want [10]", got)
+	}
+
+	// Closing node A withdraws its remaining connection of user 10; the
+	// one on node B still counts.
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedOnline(t, b, 1); !reflect.DeepEqual(got, []uint{10}) {
+		t.Fatalf("Online after node A closed = %v, want [10]", got)
+	}
+	if err := b.Leave(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortedOnline(t, b, 1); len(got) != 0 {
+		t.Fatalf("Online after everyone left = %v", got)
+	}
+}
+
+func TestRedisStaleNodeCleanup(t *testing.T) {
+	ctx := context.Background()
+	b := newTestRedis(t, testPrefix(t), "node-a")
+	defer b.Close()
+
+	if err := b.Join(ctx, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	// node-dead stopped heartbeating long ago; node-gone has no heartbeat
+	// at all. Both left presence behind.
+	stale := time.Now().Add(-2 * nodeTTL).Unix()
+	if err := b.client.ZAdd(ctx, b.prefix+"nodes", redis.Z{Score: float64(stale), Member: "node-dead"}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	key := b.presenceKey(1)
+	if err := b.client.HSet(ctx, key, "node-dead|11", 1, "node-gone|12", 1).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sortedOnline(t, b, 1); !reflect.DeepEqual(got, []uint{10}) {
+		t.Fatalf("Online = %v, want [10]", got)
+	}
+	fields, err := b.client.HKeys(ctx, key).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fields, []string{b.presenceField(10)}) {
+		t.Fatalf("presence fields after Online = %v, want only node-a's", fields)
+	}
+
+	// The next heartbeat drops the dead node from the node set.
+	b.heartbeat()
+	nodes, err := b.client.ZRange(ctx, b.prefix+"nodes", 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nodes, []string{"node-a"}) {
+		t.Fatalf("nodes after heartbeat = %v, want [node-a]", nodes)
+	}
+}
+
+func TestRedisSlowTopicDoesNotStallOthers(t *testing.T) {
+	// No connection is needed: messages are fed to route as dispatch would.
+	b := &RedisBroadcaster{topics: make(map[string]*redisTopic), stop: make(chan struct{})}
+	defer func() {
+		close(b.stop)
+		b.wg.Wait()
+	}()
+
+	release := make(chan struct{})
+	b.add("slow", func([]byte) { <-release })
+	defer close(release)
+	got := make(chan []byte, 1)
+	fast, _ := b.add("fast", func(payload []byte) { got <- payload })
+
+	// One message blocks the slow handler, the next fill its queue and the
+	// rest are dropped.
+	for i := 0; i < topicQueue+10; i++ {
+		b.route("slow", []byte("x"))
+	}
+	b.route("fast", []byte("hello"))
+	select {
+	case payload := <-got:
+		if string(payload) != "hello" {
+			t.Fatalf("fast handler got %q", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a blocked topic held up another topic")
+	}
+	if dropped := b.Dropped(); dropped == 0 || dropped > 10 {
+		t.Fatalf("Dropped = %d, want between 1 and 10", dropped)
+	}
+
+	if !b.remove("fast", fast) {
+		t.Fatal("removing the only handler did not drop the topic")
+	}
+	b.route("fast", []byte("late"))
+	select {
+	case payload := <-got:
+		t.Fatalf("unsubscribed handler got %q", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}